@@ -35,41 +35,34 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func discoverHandler(w http.ResponseWriter, r *http.Request) {
-	if url, err := openid.RedirectURL(r.FormValue("id"),
-		"http://localhost:8080/openidcallback",
-		"http://localhost:8080/"); err == nil {
-		http.Redirect(w, r, url, 303)
+func successHandler(w http.ResponseWriter, r *http.Request, id string) {
+	p := make(map[string]string)
+	p["user"] = id
+	if t, err := template.ParseFiles(dataDir + "index.html"); err == nil {
+		t.Execute(w, p)
 	} else {
 		log.Print(err)
 	}
 }
 
-func callbackHandler(w http.ResponseWriter, r *http.Request) {
-	fullUrl := "http://localhost:8080" + r.URL.String()
-	log.Print(fullUrl)
-	id, err := openid.Verify(
-		fullUrl,
-		discoveryCache, nonceStore)
-	if err == nil {
-		p := make(map[string]string)
-		p["user"] = id
-		if t, err := template.ParseFiles(dataDir + "index.html"); err == nil {
-			t.Execute(w, p)
-		} else {
-			log.Println("WTF")
-			log.Print(err)
-		}
-	} else {
-		log.Println("WTF2")
-		log.Print(err)
-	}
+func failureHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Print(err)
+	http.Error(w, "Authentication failed", http.StatusForbidden)
 }
 
 func main() {
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/discover", discoverHandler)
-	http.HandleFunc("/openidcallback", callbackHandler)
+	rp, err := openid.NewRelyingParty("http://localhost:8080/openidcallback",
+		"http://localhost:8080/", successHandler)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rp.IdentifierField = "id"
+	rp.DiscoveryCache = discoveryCache
+	rp.NonceStore = nonceStore
+	rp.Failure = failureHandler
+	http.Handle("/discover", rp.LoginHandler())
+	http.Handle("/openidcallback", rp.CallbackHandler())
 	http.ListenAndServe(":8080", nil)
 }
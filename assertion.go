@@ -0,0 +1,60 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Assertion is a verified positive assertion.
+type Assertion struct {
+	// ClaimedID is the identifier the end user is authenticated with.
+	// It is empty if the assertion is not about an identifier: only
+	// its extension data may be used then (10.1).
+	ClaimedID  string
+	OpEndpoint string
+	// Signed holds the fields of the assertion covered by its
+	// signature, with their "openid." prefix. Extension data should
+	// only be read from here.
+	Signed url.Values
+}
+
+// IsIdentity reports whether the assertion authenticates the end user.
+// Assertions that are not about an identifier must not be used to log
+// the end user in, not even with the User-Supplied Identifier.
+func (a *Assertion) IsIdentity() bool {
+	return len(a.ClaimedID) > 0
+}
+
+func newAssertion(vals url.Values) *Assertion {
+	signed := make(url.Values)
+	for _, k := range strings.Split(vals.Get("openid.signed"), ",") {
+		if vs, ok := vals["openid."+k]; ok {
+			signed["openid."+k] = vs
+		}
+	}
+	return &Assertion{
+		ClaimedID:  vals.Get("openid.claimed_id"),
+		OpEndpoint: vals.Get("openid.op_endpoint"),
+		Signed:     signed,
+	}
+}
+
+// VerifyAssertion is like VerifyRequest, or VerifyTransaction if tx is
+// not nil, but also accepts assertions without a claimed identifier,
+// such as responses carrying extension data only. Check IsIdentity
+// before logging the end user in.
+func VerifyAssertion(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (*Assertion, error) {
+	return defaultInstance.VerifyAssertion(r, tx, cache, nonceStore)
+}
+
+func (oid *OpenID) VerifyAssertion(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (*Assertion, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	if tx != nil && r.Form.Get(stateParam) != tx.State {
+		return nil, fmt.Errorf("%w: callback for another transaction", ErrStateMismatch)
+	}
+	return oid.verify(r.Context(), oid.RequestURL(r), r.Form, tx, cache, nonceStore)
+}
@@ -0,0 +1,66 @@
+package openid
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyAssertionWithoutIdentifier(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	oid := NewOpenID(server.Client())
+
+	vals := errorsTestAssertion(server.URL+"/op", "")
+	vals.Del("openid.claimed_id")
+	vals.Del("openid.identity")
+	vals.Set("openid.ns.ax", "http://openid.net/srv/ax/1.0")
+	vals.Set("openid.ax.value.email", "alice@example.com")
+	vals.Set("openid.ax.value.unsigned", "injected")
+	vals.Set("openid.signed", "op_endpoint,return_to,response_nonce,assoc_handle,ns.ax,ax.value.email")
+
+	a, err := oid.VerifyAssertion(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		nil, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if a.IsIdentity() || a.ClaimedID != "" || a.OpEndpoint != server.URL+"/op" {
+		t.Errorf("Unexpected assertion: %+v", a)
+	}
+	if a.Signed.Get("openid.ax.value.email") != "alice@example.com" {
+		t.Errorf("Missing signed extension data: %v", a.Signed)
+	}
+	if _, ok := a.Signed["openid.ax.value.unsigned"]; ok {
+		t.Errorf("Unsigned field in the signed fields: %v", a.Signed)
+	}
+
+	// It is not a login.
+	vals.Set("openid.response_nonce", vals.Get("openid.response_nonce")+"2")
+	_, err = oid.VerifyRequest(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Errorf("Expected an invalid assertion, got %v", err)
+	}
+}
+
+func TestVerifyAssertionIdentity(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	oid := NewOpenID(server.Client())
+
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	a, err := oid.VerifyAssertion(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		nil, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if err != nil || !a.IsIdentity() || a.ClaimedID != server.URL+"/id" {
+		t.Errorf("Unexpected assertion: %+v, %v", a, err)
+	}
+
+	// claimed_id and identity must be both present or both absent.
+	vals = errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	vals.Del("openid.identity")
+	_, err = oid.VerifyAssertion(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		nil, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Errorf("Expected an invalid assertion, got %v", err)
+	}
+}
@@ -1,5 +1,9 @@
 package openid
 
+import (
+	"context"
+)
+
 // 7.3.1.  Discovered Information
 // Upon successful completion of discovery, the Relying Party will
 // have one or more sets of the following information (see the
@@ -23,11 +27,40 @@ func Discover(id string) (opEndpoint, opLocalID, claimedID string, err error) {
 }
 
 func (oid *OpenID) Discover(id string) (opEndpoint, opLocalID, claimedID string, err error) {
+	return oid.DiscoverContext(context.Background(), id)
+}
+
+// DiscoverContext is like Discover, with a context for the HTTP
+// requests.
+func (oid *OpenID) DiscoverContext(ctx context.Context, id string) (opEndpoint, opLocalID, claimedID string, err error) {
+	info, err := oid.discover(ctx, id)
+	if err != nil {
+		return "", "", "", err
+	}
+	return info.opEndpoint, info.opLocalID, info.claimedID, nil
+}
+
+func (oid *OpenID) discover(ctx context.Context, id string) (*SimpleDiscoveredInfo, error) {
+	info, err := oid.discoverNormalized(ctx, id)
+	if err == nil {
+		err = oid.Endpoints.Check(info.opEndpoint)
+	}
+	if err != nil {
+		return nil, &DiscoveryError{ID: id, Err: err}
+	}
+	return info, nil
+}
+
+func (oid *OpenID) discoverNormalized(ctx context.Context, id string) (info *SimpleDiscoveredInfo, err error) {
 	// From OpenID specs, 7.2: Normalization
 	if id, err = Normalize(id); err != nil {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, oid.Limits.discoveryTimeout())
+	defer cancel()
+	ctx = withMaxRedirects(ctx, oid.Limits.maxRedirects())
+
 	// From OpenID specs, 7.3: Discovery.
 
 	// If the identifier is an XRI, [XRI_Resolution_2.0] will yield an
@@ -42,16 +75,23 @@ func (oid *OpenID) Discover(id string) (opEndpoint, opLocalID, claimedID string,
 	// If it is a URL, the Yadis protocol [Yadis] SHALL be first
 	// attempted. If it succeeds, the result is again an XRDS
 	// document.
-	if opEndpoint, opLocalID, err = yadisDiscovery(id, oid.urlGetter); err != nil {
+	if oid.YadisHead {
+		info, err = yadisHeadDiscovery(ctx, id, oid.urlGetter, &oid.Limits)
+	}
+	if info == nil {
+		info, err = yadisDiscovery(ctx, id, oid.urlGetter, &oid.Limits)
+	}
+	if err != nil {
 		// If the Yadis protocol fails and no valid XRDS document is
 		// retrieved, or no Service Elements are found in the XRDS
 		// document, the URL is retrieved and HTML-Based discovery SHALL be
 		// attempted.
-		opEndpoint, opLocalID, claimedID, err = htmlDiscovery(id, oid.urlGetter)
+		info = &SimpleDiscoveredInfo{}
+		info.opEndpoint, info.opLocalID, info.claimedID, err = htmlDiscovery(ctx, id, oid.urlGetter, &oid.Limits)
 	}
 
 	if err != nil {
-		return "", "", "", err
+		return nil, err
 	}
 	return
 }
@@ -5,26 +5,67 @@ import (
 )
 
 func TestDiscoverWithYadis(t *testing.T) {
-	// They all redirect to the same XRDS document
+	// They all redirect to the same XRDS document, with a Claimed
+	// Identifier Element. The Yadis URL is the claimed ID.
 	expectOpIDErr(t, "example.com/xrds",
-		"foo", "bar", "", false)
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/xrds", false)
 	expectOpIDErr(t, "http://example.com/xrds",
-		"foo", "bar", "", false)
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/xrds", false)
 	expectOpIDErr(t, "http://example.com/xrds-loc",
-		"foo", "bar", "", false)
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/xrds-loc", false)
 	expectOpIDErr(t, "http://example.com/xrds-meta",
-		"foo", "bar", "", false)
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/xrds-meta", false)
+	// The redirected-to URL is the claimed ID.
+	expectOpIDErr(t, "http://example.com/xrds-rel-redirect",
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/dir/xrds-rel", false)
+	// And it is normalized.
+	expectOpIDErr(t, "http://example.com/xrds-redirect",
+		"http://example.com/foo", "http://example.com/bar",
+		"http://example.com/xrds-loc", false)
+}
+
+func TestDiscoverWithYadisOPIdentifier(t *testing.T) {
+	// No claimed ID for an OP Identifier Element.
+	expectOpIDErr(t, "http://example.com/xrds-op",
+		"https://op.example.com/server", "", "", false)
+}
+
+func TestDiscoverWithYadisHead(t *testing.T) {
+	headInstance := &OpenID{urlGetter: testGetter, YadisHead: true}
+	for _, uri := range []string{
+		"http://example.com/xrds",
+		"http://example.com/xrds-loc",
+		"http://example.com/xrds-meta",
+		"http://example.com/xrds-head",
+	} {
+		opEndpoint, opLocalID, _, err := headInstance.Discover(uri)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: '%s'", uri, err)
+		} else if opEndpoint != "http://example.com/foo" || opLocalID != "http://example.com/bar" {
+			t.Errorf("Unexpected discovery for %s: %s %s", uri, opEndpoint, opLocalID)
+		}
+	}
+
+	// Without HEAD requests, the document can't be found.
+	expectOpIDErr(t, "http://example.com/xrds-head", "", "", "", true)
 }
 
 func TestDiscoverWithHtml(t *testing.T) {
 	// Yadis discovery will fail, and fall back to html.
 	expectOpIDErr(t, "http://example.com/html",
-		"example.com/openid", "bar-name", "http://example.com/html",
+		"http://example.com/openid", "http://example.com/bar-name",
+		"http://example.com/html",
 		false)
 	// The first url redirects to a different URL. The redirected-to
 	// url should be used as claimedID.
 	expectOpIDErr(t, "http://example.com/html-redirect",
-		"example.com/openid", "bar-name", "http://example.com/html",
+		"http://example.com/openid", "http://example.com/bar-name",
+		"http://example.com/html",
 		false)
 
 	expectOpIDErr(t, "http://example.com/html-multi-rel",
@@ -34,6 +75,25 @@ func TestDiscoverWithHtml(t *testing.T) {
 		false)
 }
 
+func TestDiscoverWithHtmlBase(t *testing.T) {
+	expectOpIDErr(t, "http://example.com/html-base",
+		"http://op.example.org/base/server", "http://op.example.org/me",
+		"http://example.com/html-base",
+		false)
+	expectOpIDErr(t, "http://example.com/html-bad-scheme", "", "", "", true)
+}
+
+func TestDiscoverNonRelativeLocalID(t *testing.T) {
+	expectOpIDErr(t, "http://example.com/xrds-xri-local-id",
+		"https://op.example.com/server", "=example*user",
+		"http://example.com/xrds-xri-local-id",
+		false)
+	expectOpIDErr(t, "http://example.com/html-urn-local-id",
+		"https://op.example.com/server", "urn:example:user",
+		"http://example.com/html-urn-local-id",
+		false)
+}
+
 func TestDiscoverBadUrl(t *testing.T) {
 	expectOpIDErr(t, "http://example.com/404", "", "", "", true)
 }
@@ -2,6 +2,7 @@ package openid
 
 import (
 	"sync"
+	"time"
 )
 
 type DiscoveredInfo interface {
@@ -11,6 +12,15 @@ type DiscoveredInfo interface {
 	// ProtocolVersion: it's always openId 2.
 }
 
+// ExpiringDiscoveredInfo is implemented by discovered information
+// that should not be used after a given time, for example because
+// the XRDS document it was extracted from had an <Expires> element.
+// A zero time means that the information does not expire.
+type ExpiringDiscoveredInfo interface {
+	DiscoveredInfo
+	Expires() time.Time
+}
+
 type DiscoveryCache interface {
 	Put(id string, info DiscoveredInfo)
 	// Return a discovered info, or nil.
@@ -18,9 +28,11 @@ type DiscoveryCache interface {
 }
 
 type SimpleDiscoveredInfo struct {
-	opEndpoint string
-	opLocalID  string
-	claimedID  string
+	opEndpoint  string
+	opLocalID   string
+	claimedID   string
+	canonicalID string
+	expires     time.Time
 }
 
 func (s *SimpleDiscoveredInfo) OpEndpoint() string {
@@ -35,6 +47,16 @@ func (s *SimpleDiscoveredInfo) ClaimedID() string {
 	return s.claimedID
 }
 
+// CanonicalID is the <CanonicalID> of the XRD the information was
+// discovered from, if any.
+func (s *SimpleDiscoveredInfo) CanonicalID() string {
+	return s.canonicalID
+}
+
+func (s *SimpleDiscoveredInfo) Expires() time.Time {
+	return s.expires
+}
+
 type SimpleDiscoveryCache struct {
 	cache map[string]DiscoveredInfo
 	mutex *sync.Mutex
@@ -56,11 +78,23 @@ func (s *SimpleDiscoveryCache) Get(id string) DiscoveredInfo {
 	defer s.mutex.Unlock()
 
 	if info, has := s.cache[id]; has {
+		if discoveredInfoExpired(info, time.Now()) {
+			delete(s.cache, id)
+			return nil
+		}
 		return info
 	}
 	return nil
 }
 
+func discoveredInfoExpired(info DiscoveredInfo, now time.Time) bool {
+	if e, ok := info.(ExpiringDiscoveredInfo); ok {
+		expires := e.Expires()
+		return !expires.IsZero() && !now.Before(expires)
+	}
+	return false
+}
+
 func compareDiscoveredInfo(a DiscoveredInfo, opEndpoint, opLocalID, claimedID string) bool {
 	return a != nil &&
 		a.OpEndpoint() == opEndpoint &&
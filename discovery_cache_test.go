@@ -2,6 +2,7 @@ package openid
 
 import (
 	"testing"
+	"time"
 )
 
 func TestDiscoveryCache(t *testing.T) {
@@ -22,3 +23,17 @@ func TestDiscoveryCache(t *testing.T) {
 		t.Errorf("Expected nil, got %v", di)
 	}
 }
+
+func TestDiscoveryCacheExpires(t *testing.T) {
+	dc := NewSimpleDiscoveryCache()
+
+	dc.Put("expired", &SimpleDiscoveredInfo{opEndpoint: "a", expires: time.Now().Add(-time.Minute)})
+	dc.Put("valid", &SimpleDiscoveredInfo{opEndpoint: "a", expires: time.Now().Add(time.Minute)})
+
+	if di := dc.Get("expired"); di != nil {
+		t.Errorf("Expected nil for an expired entry, got %v", di)
+	}
+	if di := dc.Get("valid"); di == nil {
+		t.Errorf("Expected a result, got nil")
+	}
+}
@@ -0,0 +1,78 @@
+package openid
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// EndpointPolicy restricts the OPs a Relying Party accepts. Each entry
+// of Allow and Deny is either an exact OP Endpoint URL, such as
+// "https://op.example.com/server", or a host pattern: "example.com"
+// matches that host only, and "*.example.com" any of its subdomains.
+//
+// The zero value accepts all OPs.
+type EndpointPolicy struct {
+	// If not empty, only the matching OP Endpoint URLs are accepted.
+	Allow []string
+	// The matching OP Endpoint URLs are refused, even if allowed.
+	Deny []string
+}
+
+// EndpointError is returned when an OP Endpoint URL is refused by the
+// EndpointPolicy, during discovery or verification. It matches
+// ErrEndpointNotAllowed.
+type EndpointError struct {
+	Endpoint string
+	// Denied is true if the endpoint is in the Deny list, false if it
+	// is not in the Allow list.
+	Denied bool
+}
+
+func (e *EndpointError) Error() string {
+	if e.Denied {
+		return fmt.Sprintf("openid: OP endpoint %s is denied", e.Endpoint)
+	}
+	return fmt.Sprintf("openid: OP endpoint %s is not allowed", e.Endpoint)
+}
+
+func (e *EndpointError) Is(target error) bool {
+	return target == ErrEndpointNotAllowed
+}
+
+// Check returns an *EndpointError if endpoint is refused.
+func (p *EndpointPolicy) Check(endpoint string) error {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || !u.IsAbs() {
+		return &EndpointError{Endpoint: endpoint}
+	}
+	if matchEndpoint(p.Deny, u) {
+		return &EndpointError{Endpoint: endpoint, Denied: true}
+	}
+	if len(p.Allow) > 0 && !matchEndpoint(p.Allow, u) {
+		return &EndpointError{Endpoint: endpoint}
+	}
+	return nil
+}
+
+func matchEndpoint(patterns []string, u *url.URL) bool {
+	normalized := normalizeURL(u)
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "://") {
+			if p, err := url.Parse(pattern); err == nil && normalizeURL(p) == normalized {
+				return true
+			}
+		} else if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, strings.ToLower(pattern[1:])) {
+				return true
+			}
+		} else if host == strings.ToLower(pattern) {
+			return true
+		}
+	}
+	return false
+}
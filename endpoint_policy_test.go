@@ -0,0 +1,84 @@
+package openid
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEndpointPolicyCheck(t *testing.T) {
+	policy := &EndpointPolicy{
+		Allow: []string{"https://op.example.com/server", "*.corp.example.com", "login.example.org"},
+		Deny:  []string{"bad.corp.example.com"},
+	}
+	tests := []struct {
+		endpoint string
+		allowed  bool
+	}{
+		{"https://op.example.com/server", true},
+		{"HTTPS://OP.example.com:443/server", true},
+		{"https://op.example.com/other", false},
+		{"http://op.example.com/server", false},
+		{"https://sso.corp.example.com/openid", true},
+		{"https://a.b.corp.example.com/openid", true},
+		{"https://corp.example.com/openid", false},
+		{"https://evilcorp.example.com/openid", false},
+		{"https://bad.corp.example.com/openid", false},
+		{"http://LOGIN.example.org:8080/op", true},
+		{"https://login.example.org.evil.com/op", false},
+		{"/relative", false},
+	}
+	for _, test := range tests {
+		err := policy.Check(test.endpoint)
+		if test.allowed && err != nil {
+			t.Errorf("%s refused: %v", test.endpoint, err)
+		} else if !test.allowed && !errors.Is(err, ErrEndpointNotAllowed) {
+			t.Errorf("%s not refused: %v", test.endpoint, err)
+		}
+	}
+
+	var denied *EndpointError
+	if err := policy.Check("https://bad.corp.example.com/openid"); !errors.As(err, &denied) || !denied.Denied {
+		t.Errorf("Expected a denied endpoint, got %v", err)
+	}
+	if err := (&EndpointPolicy{}).Check("https://any.example.com/"); err != nil {
+		t.Errorf("Zero policy refused an endpoint: %v", err)
+	}
+}
+
+func TestEndpointPolicyEnforced(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	recorder := &recordingGetter{getter: NewHTTPGetter(server.Client())}
+	oid := NewOpenIDWithGetter(recorder)
+	oid.Endpoints.Allow = []string{"https://op.example.com/server"}
+
+	var endpointErr *EndpointError
+	if _, _, _, err := oid.Discover(server.URL + "/id"); !errors.As(err, &endpointErr) || endpointErr.Endpoint != server.URL+"/op" {
+		t.Errorf("Expected an endpoint error, got %v", err)
+	}
+	if _, err := oid.RedirectURL(server.URL+"/id", "http://rp.example.com/return", ""); !errors.Is(err, ErrEndpointNotAllowed) {
+		t.Errorf("Expected an endpoint error, got %v", err)
+	}
+	if _, _, _, err := oid.Discover(server.URL + "/other"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// No request is sent to a refused OP.
+	recorder.requests = nil
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	_, err := oid.VerifyRequest(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if !errors.Is(err, ErrEndpointNotAllowed) {
+		t.Errorf("Expected an endpoint error, got %v", err)
+	}
+	if len(recorder.requests) != 0 {
+		t.Errorf("Unexpected requests: %v", recorder.requests)
+	}
+
+	oid.Endpoints = EndpointPolicy{Deny: []string{"127.0.0.1"}}
+	if _, err := oid.VerifyRequest(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore()); !errors.Is(err, ErrEndpointNotAllowed) {
+		t.Errorf("Expected an endpoint error, got %v", err)
+	}
+}
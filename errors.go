@@ -0,0 +1,213 @@
+package openid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// The errors returned by the library wrap the following sentinel
+// errors, to be tested with errors.Is.
+var (
+	// ErrSignatureRejected is returned when the OP answers a
+	// check_authentication request, but does not confirm that the
+	// signature of the assertion is valid.
+	ErrSignatureRejected = errors.New("openid: the OP did not confirm the signature")
+	// ErrNoService is returned when a discovered document contains
+	// no OpenID 2.0 service.
+	ErrNoService = errors.New("openid: no OpenID service found")
+	// ErrInvalidAssertion is returned when an assertion misses
+	// required fields, or does not sign them.
+	ErrInvalidAssertion = errors.New("openid: invalid assertion")
+	// ErrReturnToMismatch is returned when the openid.return_to URL
+	// of an assertion does not match the URL it was received at.
+	ErrReturnToMismatch = errors.New("openid: return_to does not match the request URL")
+	// ErrDiscoveredInfoMismatch is returned when the discovered
+	// information does not allow the OP to make assertions about the
+	// claimed identifier.
+	ErrDiscoveredInfoMismatch = errors.New("openid: assertion does not match the discovered information")
+	// ErrEndpointNotAllowed is returned when an OP is refused by the
+	// EndpointPolicy.
+	ErrEndpointNotAllowed = errors.New("openid: OP endpoint not allowed")
+	// ErrUnknownProvider is returned for a provider name that is not
+	// in the ProviderRegistry.
+	ErrUnknownProvider = errors.New("openid: unknown provider")
+	// ErrInvalidExtension is returned for extension fields that could
+	// override core protocol fields.
+	ErrInvalidExtension = errors.New("openid: invalid extension field")
+	// ErrInvalidSteamID is returned for claimed identifiers that are
+	// not valid Steam identifiers.
+	ErrInvalidSteamID = errors.New("openid: invalid Steam ID")
+	// ErrUnsolicited is returned for unsolicited positive assertions
+	// refused by the UnsolicitedPolicy.
+	ErrUnsolicited = errors.New("openid: unsolicited assertion")
+	// ErrEndpointMismatch is returned when an assertion comes from
+	// another OP than the one the transaction sent the end user to.
+	ErrEndpointMismatch = errors.New("openid: assertion from another OP than the transaction's")
+	// ErrNonceReplayed is returned when an assertion nonce was
+	// already accepted.
+	ErrNonceReplayed = errors.New("openid: nonce already used")
+	// ErrNonceExpired is returned when an assertion nonce is too old.
+	ErrNonceExpired = errors.New("openid: nonce too old")
+	// ErrStateMismatch is returned when a callback does not match a
+	// transaction started by the same browser.
+	ErrStateMismatch = errors.New("openid: state does not match a transaction of this browser")
+	// ErrCanceled is returned for a negative assertion: the end user
+	// cancelled the authentication (10.2.2).
+	ErrCanceled = errors.New("openid: authentication canceled")
+	// ErrSetupNeeded is returned for a negative assertion in response
+	// to a checkid_immediate request (10.2.1).
+	ErrSetupNeeded = errors.New("openid: setup needed")
+)
+
+// DiscoveryError is returned when an identifier could not be
+// discovered. Err is the cause of the last failed discovery method.
+type DiscoveryError struct {
+	ID  string
+	Err error
+}
+
+func (e *DiscoveryError) Error() string {
+	return fmt.Sprintf("openid: discovery of %s failed: %v", e.ID, e.Err)
+}
+
+func (e *DiscoveryError) Unwrap() error {
+	return e.Err
+}
+
+// SignatureError is returned when the signature of an assertion could
+// not be verified with the OP. Err is ErrSignatureRejected if the OP
+// answered that the signature is invalid, or the reason the OP could
+// not answer.
+type SignatureError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("openid: signature verification with %s failed: %v", e.Endpoint, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// ReturnToError is returned when the openid.return_to URL of an
+// assertion does not match the URL it was received at. It matches
+// ErrReturnToMismatch.
+type ReturnToError struct {
+	ReturnTo string
+	URL      string
+	Err      error
+}
+
+func (e *ReturnToError) Error() string {
+	return fmt.Sprintf("openid: return_to %s does not match %s: %v", e.ReturnTo, e.URL, e.Err)
+}
+
+func (e *ReturnToError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ReturnToError) Is(target error) bool {
+	return target == ErrReturnToMismatch
+}
+
+// DiscoveredInfoError is returned when the OP of an assertion is not
+// authorized to make assertions about its claimed identifier. It
+// matches ErrDiscoveredInfoMismatch. Err is the discovery error, if
+// the claimed identifier could not be discovered.
+type DiscoveredInfoError struct {
+	ClaimedID string
+	Endpoint  string
+	Err       error
+}
+
+func (e *DiscoveredInfoError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("openid: could not verify %s for %s: %v", e.ClaimedID, e.Endpoint, e.Err)
+	}
+	return fmt.Sprintf("openid: %s is not authorized for %s", e.Endpoint, e.ClaimedID)
+}
+
+func (e *DiscoveredInfoError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DiscoveredInfoError) Is(target error) bool {
+	return target == ErrDiscoveredInfoMismatch
+}
+
+// NonceError is returned when the nonce of an assertion is refused by
+// the NonceStore. Err is the error of the store: ErrNonceReplayed or
+// ErrNonceExpired for SimpleNonceStore.
+type NonceError struct {
+	Endpoint string
+	Nonce    string
+	Err      error
+}
+
+func (e *NonceError) Error() string {
+	return fmt.Sprintf("openid: nonce %s from %s refused: %v", e.Nonce, e.Endpoint, e.Err)
+}
+
+func (e *NonceError) Unwrap() error {
+	return e.Err
+}
+
+// FetchError is returned when an HTTP request could not be completed:
+// connection failure, timeout, blocked address, etc.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("openid: fetching %s: %v", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is returned when a server answers with a non-2xx HTTP
+// status code. For OP direct responses, Message is the "error" field
+// of the response, if any (section 5.1.2.2).
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("openid: %s returned HTTP status %d: %s", e.URL, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("openid: %s returned HTTP status %d", e.URL, e.StatusCode)
+}
+
+// MalformedDocumentError is returned when a fetched document (XRDS
+// document or Key-Value Form response) cannot be parsed.
+type MalformedDocumentError struct {
+	URL string
+	Err error
+}
+
+func (e *MalformedDocumentError) Error() string {
+	if len(e.URL) == 0 {
+		return fmt.Sprintf("openid: malformed document: %v", e.Err)
+	}
+	return fmt.Sprintf("openid: malformed document at %s: %v", e.URL, e.Err)
+}
+
+func (e *MalformedDocumentError) Unwrap() error {
+	return e.Err
+}
+
+// Returns a *StatusError if the status code of resp is not 2xx.
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{URL: documentURL(resp).String(), StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDiscoverErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<html><head><link rel="openid2.provider" href="https://op.example.com/server"></head></html>`))
+	}))
+	defer server.Close()
+
+	_, _, _, err := NewOpenID(server.Client()).Discover(server.URL + "/alice")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected a 404 StatusError, got %v", err)
+	}
+	if statusErr.URL != server.URL+"/alice" {
+		t.Errorf("Unexpected URL: %s", statusErr.URL)
+	}
+}
+
+func TestDiscoverFetchError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, _, _, err := NewOpenID(http.DefaultClient).Discover(server.URL)
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Fatalf("Expected a FetchError, got %v", err)
+	}
+}
+
+func TestMalformedXrds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xrds+xml")
+		w.Write([]byte(`<xrds:XRDS><XRD>`))
+	}))
+	defer server.Close()
+
+	_, err := getYadisResourceDescriptor(context.Background(), server.URL, "", NewHTTPGetter(server.Client()), &Limits{})
+	var malformed *MalformedDocumentError
+	if !errors.As(err, &malformed) || malformed.URL != server.URL {
+		t.Fatalf("Expected a MalformedDocumentError, got %v", err)
+	}
+}
+
+func TestVerifySignatureErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{http.StatusOK, "ns:http://specs.openid.net/auth/2.0\nis_valid:false\n", func(err error) bool {
+			return errors.Is(err, ErrSignatureRejected)
+		}},
+		// Lines without a colon are ignored.
+		{http.StatusOK, "ns:http://specs.openid.net/auth/2.0\nis_valid:true\n\r\n", func(err error) bool {
+			return err == nil
+		}},
+		{http.StatusOK, "not a key-value form", func(err error) bool {
+			var malformed *MalformedDocumentError
+			return errors.As(err, &malformed)
+		}},
+		{http.StatusOK, "is_valid:true\n", func(err error) bool {
+			var malformed *MalformedDocumentError
+			return errors.As(err, &malformed)
+		}},
+		{http.StatusInternalServerError, "<html>Internal error</html>", func(err error) bool {
+			var statusErr *StatusError
+			return errors.As(err, &statusErr) && statusErr.StatusCode == 500 && statusErr.Message == ""
+		}},
+		{http.StatusBadRequest, "ns:http://specs.openid.net/auth/2.0\nerror:unknown handle\n", func(err error) bool {
+			var statusErr *StatusError
+			return errors.As(err, &statusErr) && statusErr.StatusCode == 400 && statusErr.Message == "unknown handle"
+		}},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+		vals := url.Values{"openid.op_endpoint": {server.URL}}
+		err := verifySignature(context.Background(), vals, NewHTTPGetter(server.Client()), &Limits{})
+		if !test.check(err) {
+			t.Errorf("Unexpected error for %d %q: %v", test.status, test.body, err)
+		}
+		server.Close()
+	}
+}
+
+// Starts a fake OP at /op, confirming all signatures if valid is true,
+// and identity pages delegating to it at /id and to another OP at
+// /other.
+func newErrorsTestServer(valid bool) *httptest.Server {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/op", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("ns:http://specs.openid.net/auth/2.0\nis_valid:%t\n", valid)))
+	})
+	mux.HandleFunc("/id", func(w http.ResponseWriter, r *http.Request) {
+		(&IdentityPage{OpEndpoint: server.URL + "/op"}).ServeHTTP(w, r)
+	})
+	mux.Handle("/other", &IdentityPage{OpEndpoint: "https://op.example.com/server"})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func errorsTestAssertion(endpoint, claimedID string) url.Values {
+	return url.Values{
+		"openid.ns":             {"http://specs.openid.net/auth/2.0"},
+		"openid.mode":           {"id_res"},
+		"openid.op_endpoint":    {endpoint},
+		"openid.claimed_id":     {claimedID},
+		"openid.identity":       {claimedID},
+		"openid.return_to":      {"http://rp.example.com/return"},
+		"openid.response_nonce": {time.Now().UTC().Format(time.RFC3339) + "x"},
+		"openid.assoc_handle":   {"handle"},
+		"openid.signed":         {"op_endpoint,claimed_id,identity,return_to,response_nonce,assoc_handle"},
+		"openid.sig":            {"c2ln"},
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	oid := NewOpenID(server.Client())
+
+	verify := func(uri string, vals url.Values, nonceStore NonceStore) error {
+		_, err := oid.Verify(uri+"?"+vals.Encode(), NewSimpleDiscoveryCache(), nonceStore)
+		return err
+	}
+
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	nonceStore := NewSimpleNonceStore()
+	if err := verify("http://rp.example.com/return", vals, nonceStore); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err := verify("http://rp.example.com/return", vals, nonceStore)
+	var nonceErr *NonceError
+	if !errors.Is(err, ErrNonceReplayed) || !errors.As(err, &nonceErr) {
+		t.Errorf("Expected a replayed nonce, got %v", err)
+	}
+
+	err = verify("http://rp2.example.com/return", vals, NewSimpleNonceStore())
+	var returnToErr *ReturnToError
+	if !errors.Is(err, ErrReturnToMismatch) || !errors.As(err, &returnToErr) {
+		t.Errorf("Expected a return_to mismatch, got %v", err)
+	}
+
+	err = verify("http://rp.example.com/return", errorsTestAssertion(server.URL+"/op", server.URL+"/other"), NewSimpleNonceStore())
+	var infoErr *DiscoveredInfoError
+	if !errors.Is(err, ErrDiscoveredInfoMismatch) || !errors.As(err, &infoErr) || infoErr.Err != nil {
+		t.Errorf("Expected a discovered information mismatch, got %v", err)
+	}
+
+	err = verify("http://rp.example.com/return", errorsTestAssertion(server.URL+"/op", server.URL+"/missing"), NewSimpleNonceStore())
+	var discoveryErr *DiscoveryError
+	var statusErr *StatusError
+	if !errors.Is(err, ErrDiscoveredInfoMismatch) || !errors.As(err, &discoveryErr) || !errors.As(err, &statusErr) {
+		t.Errorf("Expected a discovery error, got %v", err)
+	}
+
+	vals = errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	vals.Set("openid.signed", "op_endpoint,return_to,response_nonce,assoc_handle")
+	if err = verify("http://rp.example.com/return", vals, NewSimpleNonceStore()); !errors.Is(err, ErrInvalidAssertion) {
+		t.Errorf("Expected an invalid assertion, got %v", err)
+	}
+}
+
+func TestVerifySignatureRejected(t *testing.T) {
+	server := newErrorsTestServer(false)
+	defer server.Close()
+
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	_, err := NewOpenID(server.Client()).Verify("http://rp.example.com/return?"+vals.Encode(),
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	var signatureErr *SignatureError
+	if !errors.Is(err, ErrSignatureRejected) || !errors.As(err, &signatureErr) {
+		t.Errorf("Expected a rejected signature, got %v", err)
+	}
+}
+
+func TestNonceStoreErrors(t *testing.T) {
+	ns := NewSimpleNonceStore()
+	old := time.Now().Add(-2 * *maxNonceAge).UTC().Format(time.RFC3339)
+	if err := ns.Accept("1", old+"x"); !errors.Is(err, ErrNonceExpired) {
+		t.Errorf("Expected an expired nonce, got %v", err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	ns.Accept("1", now+"x")
+	if err := ns.Accept("1", now+"x"); !errors.Is(err, ErrNonceReplayed) {
+		t.Errorf("Expected a replayed nonce, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package openid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 12.  Extensions
+// An extension's alias MUST NOT contain a period and MUST NOT be the
+// same as another extension's alias, or one of the names of the core
+// protocol fields below.
+var reservedAliases = map[string]bool{
+	"assoc_handle": true, "assoc_type": true, "claimed_id": true,
+	"contact": true, "delegate": true, "dh_consumer_public": true,
+	"dh_gen": true, "dh_modulus": true, "error": true, "identity": true,
+	"invalidate_handle": true, "mode": true, "ns": true,
+	"op_endpoint": true, "openid": true, "realm": true,
+	"reference": true, "response_nonce": true, "return_to": true,
+	"server": true, "session_type": true, "sig": true, "signed": true,
+	"trust_root": true,
+}
+
+// CheckExtensionKeys returns an error wrapping ErrInvalidExtension if
+// keys, the names of extension fields without the "openid." prefix,
+// are not all namespace declarations ("ns.<alias>") or fields of an
+// alias declared in keys ("<alias>.<field>"). This prevents extension
+// fields from overriding the core protocol fields.
+func CheckExtensionKeys(keys []string) error {
+	declared := make(map[string]bool)
+	for _, k := range keys {
+		if strings.HasPrefix(k, "ns.") {
+			alias := strings.TrimPrefix(k, "ns.")
+			if len(alias) == 0 || strings.Contains(alias, ".") || reservedAliases[alias] {
+				return fmt.Errorf("%w: invalid alias in %q", ErrInvalidExtension, k)
+			}
+			declared[alias] = true
+		}
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(k, "ns.") {
+			continue
+		}
+		i := strings.Index(k, ".")
+		if i <= 0 || i == len(k)-1 || !declared[k[:i]] {
+			return fmt.Errorf("%w: %q is not in a declared namespace", ErrInvalidExtension, k)
+		}
+	}
+	return nil
+}
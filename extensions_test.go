@@ -0,0 +1,32 @@
+package openid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckExtensionKeys(t *testing.T) {
+	for _, keys := range [][]string{
+		nil,
+		{"ns.sreg", "sreg.email", "sreg.nickname"},
+		{"ns.ax", "ax.mode", "ax.type.email", "ns.sreg"},
+	} {
+		if err := CheckExtensionKeys(keys); err != nil {
+			t.Errorf("%v: unexpected error: %v", keys, err)
+		}
+	}
+	for _, keys := range [][]string{
+		{"return_to"},
+		{"ns.sreg", "sreg.email", "claimed_id"},
+		{"sreg.email"},
+		{"ns.sig"},
+		{"ns.a.b"},
+		{"ns."},
+		{"ns.sreg", "sreg."},
+		{".email"},
+	} {
+		if err := CheckExtensionKeys(keys); !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("%v: expected an invalid extension, got %v", keys, err)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package openid
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 )
@@ -18,7 +20,7 @@ var testGetter = &fakeGetter{
 
 var testInstance = &OpenID{urlGetter: testGetter}
 
-func (f *fakeGetter) Get(uri string, headers map[string]string) (resp *http.Response, err error) {
+func (f *fakeGetter) Get(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error) {
 	key := uri
 	for k, v := range headers {
 		key += "#" + k + "#" + v
@@ -34,14 +36,39 @@ func (f *fakeGetter) Get(uri string, headers map[string]string) (resp *http.Resp
 			bytes.NewBuffer([]byte(doc))), request)
 	}
 	if uri, ok := f.redirects[key]; ok {
-		return f.Get(uri, headers)
+		return f.Get(ctx, uri, headers)
 	}
 
 	return nil, errors.New("404 not found")
 }
 
-func (f *fakeGetter) Post(uri string, form url.Values) (resp *http.Response, err error) {
-	return f.Get("POST@"+uri, nil)
+// Responses to HEAD requests can be registered with a "HEAD@" prefix.
+// Otherwise, the response to the equivalent GET request is returned,
+// without its body.
+func (f *fakeGetter) Head(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error) {
+	key := "HEAD@" + uri
+	for k, v := range headers {
+		key += "#" + k + "#" + v
+	}
+	if doc, ok := f.urls[key]; ok {
+		request, err := http.NewRequest("HEAD", uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(bufio.NewReader(
+			bytes.NewBuffer([]byte(doc))), request)
+	}
+
+	if resp, err = f.Get(ctx, uri, headers); err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	return resp, nil
+}
+
+func (f *fakeGetter) Post(ctx context.Context, uri string, form url.Values) (resp *http.Response, err error) {
+	return f.Get(ctx, "POST@"+uri, nil)
 }
 
 func init() {
@@ -79,12 +106,44 @@ Content-Type: text/html
 <head>
 <meta http-equiv="X-XRDS-Location" content="http://example.com/xrds">`
 
+	// Only answers HEAD requests, with a X-XRDS-Location header.
+	testGetter.urls["HEAD@http://example.com/xrds-head#Accept#application/xrds+xml"] = `HTTP/1.0 200 OK
+X-XRDS-Location: http://example.com/xrds
+
+`
+
+	// Redirects to a non-normalized URL, pointing to the valid XRDS
+	// document.
+	testGetter.redirects["http://example.com/xrds-redirect#Accept#application/xrds+xml"] = "HTTP://Example.COM:80/a/../xrds-loc"
+	testGetter.urls["HTTP://Example.COM:80/a/../xrds-loc#Accept#application/xrds+xml"] = testGetter.urls["http://example.com/xrds-loc#Accept#application/xrds+xml"]
+
+	// XRDS document with an OP Identifier Element.
+	testGetter.urls["http://example.com/xrds-op#Accept#application/xrds+xml"] = `HTTP/1.0 200 OK
+Content-Type: application/xrds+xml; charset=UTF-8
+
+<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/server</Type>
+      <URI>https://op.example.com/server</URI>
+    </Service>
+  </XRD>
+</xrds:XRDS>`
+
+	// Relative X-XRDS-Location, resolved against the redirected-to URL.
+	testGetter.redirects["http://example.com/xrds-rel-redirect#Accept#application/xrds+xml"] = "http://example.com/dir/xrds-rel"
+	testGetter.urls["http://example.com/dir/xrds-rel#Accept#application/xrds+xml"] = `HTTP/1.0 200 OK
+X-XRDS-Location: ../xrds
+
+nothing interesting here`
+
 	// === For HTML discovery ===================================
 	testGetter.urls["http://example.com/html"] = `HTTP/1.0 200 OK
 
 <html>
 <head>
-<link rel="openid2.provider" href="example.com/openid">
+<link rel="openid2.provider" href="http://example.com/openid">
 <link rel="openid2.local_id" href="bar-name">`
 
 	testGetter.redirects["http://example.com/html-redirect"] = "http://example.com/html"
@@ -99,4 +158,43 @@ Content-Type: text/html
 <link rel="openid2.local_id openid.delegate"
       href="http://exampleuser.livejournal.com/">`
 
+	testGetter.urls["http://example.com/html-base"] = `HTTP/1.0 200 OK
+Content-Type: text/html
+
+<html>
+<head>
+<base href="http://op.example.org/base/">
+<link rel="openid2.provider" href="server">
+<link rel="openid2.local_id" href="/me">`
+
+	// Non-relative OP-Local Identifiers are kept as is.
+	testGetter.urls["http://example.com/xrds-xri-local-id#Accept#application/xrds+xml"] = `HTTP/1.0 200 OK
+Content-Type: application/xrds+xml; charset=UTF-8
+
+<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/signon</Type>
+      <URI>https://op.example.com/server</URI>
+      <LocalID>=example*user</LocalID>
+    </Service>
+  </XRD>
+</xrds:XRDS>`
+
+	testGetter.urls["http://example.com/html-urn-local-id"] = `HTTP/1.0 200 OK
+Content-Type: text/html
+
+<html>
+<head>
+<link rel="openid2.provider" href="https://op.example.com/server">
+<link rel="openid2.local_id" href="urn:example:user">`
+
+	testGetter.urls["http://example.com/html-bad-scheme"] = `HTTP/1.0 200 OK
+Content-Type: text/html
+
+<html>
+<head>
+<link rel="openid2.provider" href="javascript:alert(1)">`
+
 }
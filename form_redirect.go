@@ -0,0 +1,95 @@
+package openid
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MaxRedirectURLLength is the length of the longest URL Redirect sends
+// with an HTTP redirect. Some user agents and servers do not support
+// URLs longer than about 2000 characters.
+const MaxRedirectURLLength = 2000
+
+// Redirect sends the user agent to redirectURL, an indirect message
+// such as the URL returned by RedirectURL. If the URL is longer than
+// MaxRedirectURLLength, its openid.* parameters are instead POSTed with
+// an auto-submitting HTML form (5.2.1), and the other parameters are
+// kept in the form action URL.
+func Redirect(w http.ResponseWriter, r *http.Request, redirectURL string) {
+	if len(redirectURL) <= MaxRedirectURLLength {
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+		return
+	}
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	form := make(url.Values)
+	for k, vs := range query {
+		if strings.HasPrefix(k, "openid.") {
+			form[k] = vs
+			delete(query, k)
+		}
+	}
+	u.RawQuery = query.Encode()
+	WriteFormRedirect(w, u.String(), form)
+}
+
+type formField struct {
+	Name, Value string
+}
+
+var formRedirectTemplate = template.Must(template.New("form").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>OpenID</title>
+</head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}" accept-charset="UTF-8">
+{{range .Fields}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}<noscript><input type="submit" value="Continue"></noscript>
+</form>
+</body>
+</html>
+`))
+
+// WriteFormRedirect writes an HTML page POSTing values to action as
+// soon as it is loaded: the HTML FORM Redirection of section 5.2.1.
+// Without JavaScript, the user has to submit the form.
+func WriteFormRedirect(w http.ResponseWriter, action string, values url.Values) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := []formField{}
+	for _, k := range keys {
+		for _, v := range values[k] {
+			fields = append(fields, formField{k, v})
+		}
+	}
+	var buf bytes.Buffer
+	err := formRedirectTemplate.Execute(&buf, struct {
+		Action string
+		Fields []formField
+	}{action, fields})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,64 @@
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// Returns the action and fields of the first form of an HTML page.
+func parseForm(t *testing.T, body string) (action string, fields url.Values) {
+	fields = make(url.Values)
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tk := tokenizer.Token()
+			if tk.Data == "form" {
+				action = attrValue(tk, "action")
+				if attrValue(tk, "method") != "post" {
+					t.Errorf("Unexpected form method: %s", attrValue(tk, "method"))
+				}
+			} else if tk.Data == "input" && attrValue(tk, "type") == "hidden" {
+				fields.Add(attrValue(tk, "name"), attrValue(tk, "value"))
+			}
+		}
+	}
+}
+
+func TestRedirectShortURL(t *testing.T) {
+	redirectURL := "https://op.example.com/server?openid.mode=checkid_setup"
+	w := httptest.NewRecorder()
+	Redirect(w, httptest.NewRequest("GET", "/login", nil), redirectURL)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != redirectURL {
+		t.Errorf("Unexpected response: %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRedirectLongURL(t *testing.T) {
+	long := strings.Repeat("x", MaxRedirectURLLength)
+	redirectURL := "https://op.example.com/server?session=a&b&openid.mode=checkid_setup&openid.ax.value=" + long + "&openid.quote=%22%3C"
+	w := httptest.NewRecorder()
+	Redirect(w, httptest.NewRequest("GET", "/login", nil), redirectURL)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	action, fields := parseForm(t, w.Body.String())
+	if action != "https://op.example.com/server?b=&session=a" {
+		t.Errorf("Unexpected action: %s", action)
+	}
+	expected := url.Values{
+		"openid.mode":     {"checkid_setup"},
+		"openid.ax.value": {long},
+		"openid.quote":    {`"<`},
+	}
+	if fields.Encode() != expected.Encode() {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+}
@@ -1,22 +1,64 @@
 package openid
 
 import (
+	"context"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
-// Interface that simplifies testing.
-type httpGetter interface {
-	Get(uri string, headers map[string]string) (resp *http.Response, err error)
-	Post(uri string, form url.Values) (resp *http.Response, err error)
+// HTTPGetter performs all the HTTP requests of the library: discovery
+// fetches (GET and HEAD) and direct requests to OPs (POST). Provide
+// your own implementation to NewOpenIDWithGetter to route requests
+// through a proxy, record and replay them, inject faults, etc.
+//
+// The returned response must have its Request field set to the
+// request that was eventually sent, after redirects: its URL is used
+// as the claimed identifier and to resolve relative URLs.
+type HTTPGetter interface {
+	Get(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error)
+	Head(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error)
+	Post(ctx context.Context, uri string, form url.Values) (resp *http.Response, err error)
+}
+
+// NewHTTPGetter returns the HTTPGetter used by NewOpenID, which sends
+// requests with client. It can be wrapped by custom implementations.
+//
+// The returned getter stops following redirects after
+// Limits.MaxRedirects, with a *LimitError. A CheckRedirect function
+// of client is still called for the redirects within that limit.
+func NewHTTPGetter(client *http.Client) HTTPGetter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	limited := *client
+	checkRedirect := client.CheckRedirect
+	limited.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if max := maxRedirectsFromContext(req.Context()); len(via) > max {
+			return &LimitError{What: "redirects", Limit: int64(max)}
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		return nil
+	}
+	return &defaultGetter{client: &limited}
 }
 
 type defaultGetter struct {
 	client *http.Client
 }
 
-func (dg *defaultGetter) Get(uri string, headers map[string]string) (resp *http.Response, err error) {
-	request, err := http.NewRequest("GET", uri, nil)
+func (dg *defaultGetter) Get(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error) {
+	return dg.do(ctx, "GET", uri, headers)
+}
+
+func (dg *defaultGetter) Head(ctx context.Context, uri string, headers map[string]string) (resp *http.Response, err error) {
+	return dg.do(ctx, "HEAD", uri, headers)
+}
+
+func (dg *defaultGetter) do(ctx context.Context, method, uri string, headers map[string]string) (resp *http.Response, err error) {
+	request, err := http.NewRequestWithContext(ctx, method, uri, nil)
 	if err != nil {
 		return
 	}
@@ -26,6 +68,11 @@ func (dg *defaultGetter) Get(uri string, headers map[string]string) (resp *http.
 	return dg.client.Do(request)
 }
 
-func (dg *defaultGetter) Post(uri string, form url.Values) (resp *http.Response, err error) {
-	return dg.client.PostForm(uri, form)
+func (dg *defaultGetter) Post(ctx context.Context, uri string, form url.Values) (resp *http.Response, err error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return dg.client.Do(request)
 }
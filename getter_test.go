@@ -0,0 +1,67 @@
+package openid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Records the requests, and delegates to another HTTPGetter.
+type recordingGetter struct {
+	getter   HTTPGetter
+	requests []string
+}
+
+func (r *recordingGetter) Get(ctx context.Context, uri string, headers map[string]string) (*http.Response, error) {
+	r.requests = append(r.requests, "GET "+uri)
+	return r.getter.Get(ctx, uri, headers)
+}
+
+func (r *recordingGetter) Head(ctx context.Context, uri string, headers map[string]string) (*http.Response, error) {
+	r.requests = append(r.requests, "HEAD "+uri)
+	return r.getter.Head(ctx, uri, headers)
+}
+
+func (r *recordingGetter) Post(ctx context.Context, uri string, form url.Values) (*http.Response, error) {
+	r.requests = append(r.requests, "POST "+uri)
+	return r.getter.Post(ctx, uri, form)
+}
+
+func TestNewOpenIDWithGetter(t *testing.T) {
+	server := httptest.NewServer(&IdentityPage{OpEndpoint: "https://op.example.com/server"})
+	defer server.Close()
+
+	recorder := &recordingGetter{getter: NewHTTPGetter(server.Client())}
+	oid := NewOpenIDWithGetter(recorder)
+	oid.YadisHead = true
+	opEndpoint, _, _, err := oid.Discover(server.URL + "/alice")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if opEndpoint != "https://op.example.com/server" {
+		t.Errorf("Unexpected endpoint: %s", opEndpoint)
+	}
+	// HEAD, then GET for Yadis, then GET for HTML discovery.
+	expected := []string{"HEAD " + server.URL + "/alice", "GET " + server.URL + "/alice", "GET " + server.URL + "/alice"}
+	if len(recorder.requests) != len(expected) {
+		t.Fatalf("Unexpected requests: %v", recorder.requests)
+	}
+	for i := range expected {
+		if recorder.requests[i] != expected[i] {
+			t.Errorf("Unexpected request: Expected %s, Got %s", expected[i], recorder.requests[i])
+		}
+	}
+}
+
+func TestDiscoverContextCanceled(t *testing.T) {
+	server := httptest.NewServer(&IdentityPage{OpEndpoint: "https://op.example.com/server"})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err := NewOpenID(server.Client()).DiscoverContext(ctx, server.URL); err == nil {
+		t.Errorf("Expected an error with a canceled context")
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/yohcop/openid-go
 
-go 1.3
+go 1.13
 
 require golang.org/x/net v0.7.0
@@ -0,0 +1,168 @@
+package openid
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// SuccessFunc is called by a RelyingParty when the end user is
+// authenticated with the claimed identifier id. It typically starts a
+// session, and redirects the end user.
+type SuccessFunc func(w http.ResponseWriter, r *http.Request, id string)
+
+// FailureFunc is called by a RelyingParty when the authentication
+// fails, during discovery or verification. err can be inspected with
+// errors.Is and errors.As: it is ErrCanceled if the end user cancelled
+// the authentication at the OP, for example.
+type FailureFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// RelyingParty serves the login and callback endpoints of a Relying
+// Party. The login endpoint discovers the identifier submitted in the
+// IdentifierField form field and redirects the end user to the OP; the
+// callback endpoint verifies the assertion sent back by the OP, then
+// calls Success or Failure.
+//
+// ServeHTTP dispatches requests on LoginPath and CallbackPath, so that
+// a RelyingParty can be mounted on a mux as is. LoginHandler and
+// CallbackHandler can be used instead to mount them separately.
+type RelyingParty struct {
+	// OpenID is used for all HTTP requests. The default instance is
+	// used if nil.
+	OpenID *OpenID
+	// CallbackURL is the URL of the callback endpoint, as seen by the
+	// end user: it is sent as the openid.return_to URL.
+	CallbackURL string
+	// Realm is optional (9.2).
+	Realm string
+
+	LoginPath    string
+	CallbackPath string
+	// The form field with the User-Supplied Identifier.
+	IdentifierField string
+
+	DiscoveryCache DiscoveryCache
+	NonceStore     NonceStore
+	// Transactions binds the callbacks to the browser that started the
+	// login, against CSRF and login fixation. If nil, any valid
+	// assertion is accepted by the callback endpoint.
+	Transactions TransactionStore
+
+	Success SuccessFunc
+	// Failure is optional: by default, a 403 error page is served.
+	Failure FailureFunc
+}
+
+// NewRelyingParty returns a RelyingParty with in-memory discovery
+// cache and nonce store, serving its login endpoint at /openid/login
+// and its callback endpoint at the path of callbackURL. The identifier
+// is read from the openid_identifier field recommended by section 7.1.
+// Transactions are stored in cookies signed with a random key.
+// If you run multiple servers, use stores and a key shared between
+// them instead.
+func NewRelyingParty(callbackURL, realm string, success SuccessFunc) (*RelyingParty, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("Callback URL must be an absolute http(s) URL: " + callbackURL)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	transactions := NewCookieTransactionStore(key)
+	transactions.Secure = u.Scheme == "https"
+	return &RelyingParty{
+		CallbackURL:     callbackURL,
+		Realm:           realm,
+		LoginPath:       "/openid/login",
+		CallbackPath:    u.Path,
+		IdentifierField: "openid_identifier",
+		DiscoveryCache:  NewSimpleDiscoveryCache(),
+		NonceStore:      NewSimpleNonceStore(),
+		Transactions:    transactions,
+		Success:         success,
+	}, nil
+}
+
+func (rp *RelyingParty) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case rp.LoginPath:
+		rp.login(w, r)
+	case rp.CallbackPath:
+		rp.callback(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// LoginHandler returns the handler of the login endpoint, accepting
+// both GET and POST requests.
+func (rp *RelyingParty) LoginHandler() http.Handler {
+	return http.HandlerFunc(rp.login)
+}
+
+// CallbackHandler returns the handler of the callback endpoint.
+func (rp *RelyingParty) CallbackHandler() http.Handler {
+	return http.HandlerFunc(rp.callback)
+}
+
+func (rp *RelyingParty) openID() *OpenID {
+	if rp.OpenID != nil {
+		return rp.OpenID
+	}
+	return defaultInstance
+}
+
+func (rp *RelyingParty) login(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue(rp.IdentifierField)
+	if rp.Transactions == nil {
+		redirectURL, err := rp.openID().RedirectURLWithCache(r.Context(), id, rp.CallbackURL, rp.Realm, rp.DiscoveryCache)
+		if err != nil {
+			rp.fail(w, r, err)
+			return
+		}
+		Redirect(w, r, redirectURL)
+		return
+	}
+	tx, redirectURL, err := rp.openID().StartTransaction(r.Context(), id, rp.CallbackURL, rp.Realm)
+	if err != nil {
+		rp.fail(w, r, err)
+		return
+	}
+	if err = rp.Transactions.Save(w, r, tx); err != nil {
+		rp.fail(w, r, err)
+		return
+	}
+	Redirect(w, r, redirectURL)
+}
+
+func (rp *RelyingParty) callback(w http.ResponseWriter, r *http.Request) {
+	var id string
+	var err error
+	if rp.Transactions == nil {
+		id, err = rp.openID().VerifyRequest(r, rp.DiscoveryCache, rp.NonceStore)
+	} else {
+		// The state is part of the return_to URL, checked by Verify.
+		var tx *Transaction
+		if tx, err = rp.Transactions.Load(w, r, r.FormValue(stateParam)); err == nil {
+			id, err = rp.openID().VerifyTransaction(r, tx, rp.DiscoveryCache, rp.NonceStore)
+		}
+	}
+	if err != nil {
+		rp.fail(w, r, err)
+		return
+	}
+	rp.Success(w, r, id)
+}
+
+func (rp *RelyingParty) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if rp.Failure != nil {
+		rp.Failure(w, r, err)
+		return
+	}
+	http.Error(w, "OpenID authentication failed", http.StatusForbidden)
+}
@@ -0,0 +1,160 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewRelyingPartyInvalidCallback(t *testing.T) {
+	for _, callback := range []string{"/callback", "ftp://rp.example.com/callback", "http://%zz"} {
+		if _, err := NewRelyingParty(callback, "", nil); err == nil {
+			t.Errorf("Accepted callback URL %s", callback)
+		}
+	}
+}
+
+func TestRelyingPartyLogin(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+
+	rp, err := NewRelyingParty("http://rp.example.com/openid/callback", "http://rp.example.com/", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rp.OpenID = NewOpenID(server.Client())
+
+	w := httptest.NewRecorder()
+	rp.ServeHTTP(w, httptest.NewRequest("GET", "/openid/login?openid_identifier="+url.QueryEscape(server.URL+"/id"), nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect, got %d", w.Code)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if !strings.HasPrefix(location.String(), server.URL+"/op?") ||
+		!strings.HasPrefix(location.Query().Get("openid.return_to"), "http://rp.example.com/openid/callback?rp_state=") ||
+		location.Query().Get("openid.claimed_id") != server.URL+"/id" {
+		t.Errorf("Unexpected redirect: %s", location)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !strings.HasPrefix(cookies[0].Name, "openid_tx_") || !cookies[0].HttpOnly {
+		t.Errorf("Unexpected cookies: %v", cookies)
+	}
+
+	// Without Failure, a 403 is served.
+	w = httptest.NewRecorder()
+	rp.ServeHTTP(w, httptest.NewRequest("GET", "/openid/login", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a 403, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	rp.ServeHTTP(w, httptest.NewRequest("GET", "/openid/other", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected a 404, got %d", w.Code)
+	}
+}
+
+func TestRelyingPartyCallback(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+
+	var success string
+	var failure error
+	rp, err := NewRelyingParty("http://rp.example.com/return", "", func(w http.ResponseWriter, r *http.Request, id string) {
+		success = id
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rp.Failure = func(w http.ResponseWriter, r *http.Request, err error) {
+		failure = err
+	}
+	rp.OpenID = NewOpenID(server.Client())
+	rp.Transactions = nil
+
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	callback := rp.CallbackHandler()
+	callback.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil))
+	if success != server.URL+"/id" || failure != nil {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+
+	// Replayed.
+	success = ""
+	callback.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil))
+	if success != "" || !errors.Is(failure, ErrNonceReplayed) {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+}
+
+func TestRelyingPartyState(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+
+	var success string
+	var failure error
+	rp, err := NewRelyingParty("http://rp.example.com/return", "", func(w http.ResponseWriter, r *http.Request, id string) {
+		success = id
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rp.Failure = func(w http.ResponseWriter, r *http.Request, err error) {
+		failure = err
+	}
+	rp.OpenID = NewOpenID(server.Client())
+
+	// Starts a login, and returns the callback request with the
+	// assertion, and the transaction cookie.
+	login := func() (*http.Request, *http.Cookie) {
+		w := httptest.NewRecorder()
+		rp.LoginHandler().ServeHTTP(w, httptest.NewRequest("GET", "/login?openid_identifier="+url.QueryEscape(server.URL+"/id"), nil))
+		location, _ := url.Parse(w.Header().Get("Location"))
+		vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+		returnTo := location.Query().Get("openid.return_to")
+		vals.Set("openid.return_to", returnTo)
+		r := httptest.NewRequest("GET", returnTo+"&"+vals.Encode(), nil)
+		return r, w.Result().Cookies()[0]
+	}
+	callback := func(r *http.Request) {
+		success, failure = "", nil
+		rp.CallbackHandler().ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	r, cookie := login()
+	r.AddCookie(cookie)
+	callback(r)
+	if success != server.URL+"/id" || failure != nil {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+
+	// Without the cookie: an attacker's assertion in the victim's
+	// browser.
+	r, _ = login()
+	callback(r)
+	if success != "" || !errors.Is(failure, ErrStateMismatch) {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+
+	// With the cookie of another transaction.
+	r, _ = login()
+	_, cookie = login()
+	cookie.Name = "openid_tx_" + r.URL.Query().Get("rp_state")
+	r.AddCookie(cookie)
+	callback(r)
+	if success != "" || !errors.Is(failure, ErrStateMismatch) {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+
+	// With a forged cookie.
+	r, cookie = login()
+	cookie.Value = cookie.Value[:len(cookie.Value)-2] + "xx"
+	r.AddCookie(cookie)
+	callback(r)
+	if success != "" || !errors.Is(failure, ErrStateMismatch) {
+		t.Errorf("Unexpected result: %s, %v", success, failure)
+	}
+}
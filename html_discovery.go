@@ -1,23 +1,40 @@
 package openid
 
 import (
-	"errors"
+	"context"
 	"io"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-func htmlDiscovery(id string, getter httpGetter) (opEndpoint, opLocalID, claimedID string, err error) {
-	resp, err := getter.Get(id, nil)
+func htmlDiscovery(ctx context.Context, id string, getter HTTPGetter, limits *Limits) (opEndpoint, opLocalID, claimedID string, err error) {
+	resp, err := getter.Get(ctx, id, nil)
 	if err != nil {
+		return "", "", "", &FetchError{URL: id, Err: err}
+	}
+	defer resp.Body.Close()
+	if err = checkStatus(resp); err != nil {
+		return "", "", "", err
+	}
+	opEndpoint, opLocalID, baseHref, err := findProviderFromHeadLink(limitReader(resp.Body, limits.maxHTMLSize(), "HTML document"))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// Relative hrefs are resolved against the <base> element if any,
+	// or the URL of the page, after redirects.
+	docURL := documentURL(resp)
+	if opEndpoint, err = resolveURL(docURL, baseHref, opEndpoint); err != nil {
 		return "", "", "", err
 	}
-	opEndpoint, opLocalID, err = findProviderFromHeadLink(resp.Body)
-	return opEndpoint, opLocalID, resp.Request.URL.String(), err
+	if opLocalID, err = resolveLocalID(docURL, baseHref, opLocalID); err != nil {
+		return "", "", "", err
+	}
+	return opEndpoint, opLocalID, normalizeURL(docURL), nil
 }
 
-func findProviderFromHeadLink(input io.Reader) (opEndpoint, opLocalID string, err error) {
+func findProviderFromHeadLink(input io.Reader) (opEndpoint, opLocalID, baseHref string, err error) {
 	tokenizer := html.NewTokenizer(input)
 	inHead := false
 	for {
@@ -30,7 +47,10 @@ func findProviderFromHeadLink(input io.Reader) (opEndpoint, opLocalID string, er
 			if len(opEndpoint) > 0 {
 				return
 			}
-			return "", "", tokenizer.Err()
+			if err := tokenizer.Err(); err != io.EOF {
+				return "", "", "", err
+			}
+			return "", "", "", ErrNoService
 		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
 			tk := tokenizer.Token()
 			if tk.Data == "head" {
@@ -40,9 +60,10 @@ func findProviderFromHeadLink(input io.Reader) (opEndpoint, opLocalID string, er
 					if len(opEndpoint) > 0 {
 						return
 					}
-					return "", "", errors.New(
-						"LINK with rel=openid2.provider not found")
+					return "", "", "", ErrNoService
 				}
+			} else if inHead && tk.Data == "base" && len(baseHref) == 0 {
+				baseHref = attrValue(tk, "href")
 			} else if inHead && tk.Data == "link" {
 				provider := false
 				localID := false
@@ -74,11 +95,13 @@ func findProviderFromHeadLink(input io.Reader) (opEndpoint, opLocalID string, er
 			}
 		}
 	}
-	// At this point we should probably have returned either from
-	// a closing </head> or a tokenizer error (no </head> found).
-	// But just in case.
-	if len(opEndpoint) > 0 {
-		return
+}
+
+func attrValue(tk html.Token, key string) string {
+	for _, attr := range tk.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
 	}
-	return "", "", errors.New("LINK rel=openid2.provider not found")
+	return ""
 }
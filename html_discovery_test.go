@@ -46,7 +46,7 @@ func TestNoEndpointFromLink(t *testing.T) {
 
 func searchLink(t *testing.T, doc, opEndpoint, claimedID string, err bool) {
 	r := bytes.NewReader([]byte(doc))
-	op, id, e := findProviderFromHeadLink(r)
+	op, id, _, e := findProviderFromHeadLink(r)
 	if (e != nil) != err {
 		t.Errorf("Unexpected error: '%s'", e)
 	} else if e == nil {
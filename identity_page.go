@@ -0,0 +1,53 @@
+package openid
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// IdentityPage is the HTML document served at an identifier URL. It
+// contains the markup used by HTML-Based discovery (7.3.3), and can
+// point to an XRDS document for Yadis discovery.
+type IdentityPage struct {
+	OpEndpoint string
+	// Optional.
+	OpLocalID string
+	// Optional: the URL of the XRDS document, advertised with both the
+	// X-XRDS-Location header (when served with ServeHTTP) and a <meta>
+	// element.
+	XrdsLocation string
+	Title        string
+}
+
+var identityPageTemplate = template.Must(template.New("identity").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{if .XrdsLocation}}<meta http-equiv="X-XRDS-Location" content="{{.XrdsLocation}}">
+{{end}}<link rel="openid2.provider" href="{{.OpEndpoint}}">
+{{if .OpLocalID}}<link rel="openid2.local_id" href="{{.OpLocalID}}">
+{{end}}<title>{{.Title}}</title>
+</head>
+<body>
+</body>
+</html>
+`))
+
+func (p *IdentityPage) Render(w io.Writer) error {
+	return identityPageTemplate.Execute(w, p)
+}
+
+func (p *IdentityPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := p.Render(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(p.XrdsLocation) > 0 {
+		SetXrdsLocation(w, p.XrdsLocation)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Write(buf.Bytes())
+}
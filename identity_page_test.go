@@ -0,0 +1,35 @@
+package openid
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdentityPageRoundTrip(t *testing.T) {
+	for _, page := range []*IdentityPage{
+		{OpEndpoint: "https://op.example.com/server"},
+		{OpEndpoint: "https://op.example.com/server?a=1&b=2",
+			OpLocalID: "https://op.example.com/id/alice",
+			Title:     "Alice <3"},
+	} {
+		var buf bytes.Buffer
+		if err := page.Render(&buf); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		searchLink(t, buf.String(), page.OpEndpoint, page.OpLocalID, false)
+	}
+}
+
+func TestIdentityPageXrdsLocation(t *testing.T) {
+	page := &IdentityPage{
+		OpEndpoint:   "https://op.example.com/server",
+		XrdsLocation: "https://op.example.com/xrds/alice",
+	}
+	w := httptest.NewRecorder()
+	page.ServeHTTP(w, httptest.NewRequest("GET", "https://op.example.com/alice", nil))
+	if l := w.Header().Get("X-XRDS-Location"); l != page.XrdsLocation {
+		t.Errorf("Unexpected X-XRDS-Location header: %s", l)
+	}
+	searchMeta(t, w.Body.String(), page.XrdsLocation, false)
+}
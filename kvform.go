@@ -0,0 +1,51 @@
+package openid
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 4.1.1.  Key-Value Form Encoding
+// A message in Key-Value form is a sequence of lines. Each line
+// begins with a key, followed by a colon, and the value associated
+// with the key. The line is terminated by a single newline (UCS
+// codepoint 10, "\n"). A key or value MUST NOT contain a newline and
+// a key also MUST NOT contain a colon.
+//
+// Key-Value form is used for the body of direct responses, and for
+// computing signatures.
+
+// ParseKeyValueForm decodes a message in Key-Value form. Empty lines
+// are ignored.
+func ParseKeyValueForm(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("Malformed Key-Value form line: %q", line)
+		}
+		values[line[:i]] = line[i+1:]
+	}
+	return values, nil
+}
+
+// EncodeKeyValueForm encodes keys, in this order, with their values
+// from vals, as a message in Key-Value form.
+func EncodeKeyValueForm(keys []string, vals map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v := vals[k]
+		if strings.ContainsAny(k, ":\n") || strings.Contains(v, "\n") {
+			return nil, fmt.Errorf("Invalid Key-Value form pair: %q:%q", k, v)
+		}
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		buf.WriteString(v)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
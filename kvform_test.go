@@ -0,0 +1,44 @@
+package openid
+
+import (
+	"testing"
+)
+
+func TestKeyValueForm(t *testing.T) {
+	kv, err := EncodeKeyValueForm(
+		[]string{"mode", "ns", "url"},
+		map[string]string{
+			"mode": "id_res",
+			"ns":   "http://specs.openid.net/auth/2.0",
+			"url":  "http://example.com/a:b",
+		})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "mode:id_res\nns:http://specs.openid.net/auth/2.0\nurl:http://example.com/a:b\n"
+	if string(kv) != expected {
+		t.Errorf("Unexpected encoding: Expected %q, Got %q", expected, kv)
+	}
+
+	vals, err := ParseKeyValueForm(kv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(vals) != 3 || vals["mode"] != "id_res" ||
+		vals["ns"] != "http://specs.openid.net/auth/2.0" ||
+		vals["url"] != "http://example.com/a:b" {
+		t.Errorf("Unexpected decoding: %v", vals)
+	}
+}
+
+func TestKeyValueFormErrors(t *testing.T) {
+	if _, err := EncodeKeyValueForm([]string{"a:b"}, map[string]string{"a:b": "c"}); err == nil {
+		t.Errorf("Expected an error for a key with a colon")
+	}
+	if _, err := EncodeKeyValueForm([]string{"a"}, map[string]string{"a": "b\nc"}); err == nil {
+		t.Errorf("Expected an error for a value with a newline")
+	}
+	if _, err := ParseKeyValueForm([]byte("a:b\nmalformed\n")); err == nil {
+		t.Errorf("Expected an error for a line without a colon")
+	}
+}
@@ -0,0 +1,165 @@
+package openid
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Limits bound the resources used to fetch documents from servers
+// that are not trusted: identity pages, XRDS documents and OP
+// responses. Zero values mean the defaults from DefaultLimits.
+type Limits struct {
+	// Maximum sizes, in bytes, of response bodies.
+	MaxXrdsSize     int64
+	MaxHTMLSize     int64
+	MaxKeyValueSize int64
+	// Maximum duration of the whole discovery of an identifier
+	// (including Yadis and HTML-based discovery), and of the direct
+	// verification of a signature with the OP.
+	DiscoveryTimeout    time.Duration
+	VerificationTimeout time.Duration
+	// Maximum number of redirects followed by a request. A negative
+	// value disables redirects. Only enforced by HTTPGetters created
+	// with NewHTTPGetter.
+	MaxRedirects int
+}
+
+const (
+	defaultMaxXrdsSize         = 1 << 20
+	defaultMaxHTMLSize         = 1 << 20
+	defaultMaxKeyValueSize     = 64 << 10
+	defaultDiscoveryTimeout    = 30 * time.Second
+	defaultVerificationTimeout = 30 * time.Second
+	defaultMaxRedirects        = 10
+)
+
+// DefaultLimits returns the limits of the instances created with
+// NewOpenID.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxXrdsSize:         defaultMaxXrdsSize,
+		MaxHTMLSize:         defaultMaxHTMLSize,
+		MaxKeyValueSize:     defaultMaxKeyValueSize,
+		DiscoveryTimeout:    defaultDiscoveryTimeout,
+		VerificationTimeout: defaultVerificationTimeout,
+		MaxRedirects:        defaultMaxRedirects,
+	}
+}
+
+// LimitError is returned when a response exceeds one of the Limits.
+type LimitError struct {
+	// What exceeded the limit: "XRDS document", "HTML document",
+	// "Key-Value response" or "redirects".
+	What  string
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("openid: %s exceeds the limit of %d", e.What, e.Limit)
+}
+
+func (l *Limits) maxXrdsSize() int64 {
+	if l.MaxXrdsSize > 0 {
+		return l.MaxXrdsSize
+	}
+	return defaultMaxXrdsSize
+}
+
+func (l *Limits) maxHTMLSize() int64 {
+	if l.MaxHTMLSize > 0 {
+		return l.MaxHTMLSize
+	}
+	return defaultMaxHTMLSize
+}
+
+func (l *Limits) maxKeyValueSize() int64 {
+	if l.MaxKeyValueSize > 0 {
+		return l.MaxKeyValueSize
+	}
+	return defaultMaxKeyValueSize
+}
+
+func (l *Limits) discoveryTimeout() time.Duration {
+	if l.DiscoveryTimeout > 0 {
+		return l.DiscoveryTimeout
+	}
+	return defaultDiscoveryTimeout
+}
+
+func (l *Limits) verificationTimeout() time.Duration {
+	if l.VerificationTimeout > 0 {
+		return l.VerificationTimeout
+	}
+	return defaultVerificationTimeout
+}
+
+func (l *Limits) maxRedirects() int {
+	if l.MaxRedirects > 0 {
+		return l.MaxRedirects
+	}
+	if l.MaxRedirects < 0 {
+		return 0
+	}
+	return defaultMaxRedirects
+}
+
+// Returns a reader failing with a *LimitError once more than max
+// bytes have been read from r.
+func limitReader(r io.Reader, max int64, what string) io.Reader {
+	return &limitedReader{r: r, remaining: max, err: &LimitError{What: what, Limit: max}}
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.remaining < 0 {
+		return 0, l.err
+	}
+	// Read one byte more than allowed, to detect bodies that are
+	// too large rather than silently truncating them.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err = l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, l.err
+	}
+	return n, err
+}
+
+// Reads the body of resp, up to max bytes. Read errors other than
+// exceeding the limit are reported as a *FetchError.
+func readBody(resp *http.Response, max int64, what string) ([]byte, error) {
+	body, err := ioutil.ReadAll(limitReader(resp.Body, max, what))
+	if err != nil {
+		if _, ok := err.(*LimitError); !ok {
+			err = &FetchError{URL: documentURL(resp).String(), Err: err}
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+type maxRedirectsKey struct{}
+
+// The maximum number of redirects is passed to the HTTPGetter in the
+// context of the requests.
+func withMaxRedirects(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, maxRedirectsKey{}, max)
+}
+
+func maxRedirectsFromContext(ctx context.Context) int {
+	if max, ok := ctx.Value(maxRedirectsKey{}).(int); ok {
+		return max
+	}
+	return defaultMaxRedirects
+}
@@ -0,0 +1,108 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscoverDocumentTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head>" + strings.Repeat("<!-- padding -->", 1000)))
+		w.Write([]byte(`<link rel="openid2.provider" href="https://op.example.com/server"></head></html>`))
+	}))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Limits.MaxHTMLSize = 1024
+	_, _, _, err := oid.Discover(server.URL)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected a LimitError, got %v", err)
+	}
+	if limitErr.What != "HTML document" || limitErr.Limit != 1024 {
+		t.Errorf("Unexpected error: %v", limitErr)
+	}
+
+	// Within the default limits.
+	oid.Limits = DefaultLimits()
+	if opEndpoint, _, _, err := oid.Discover(server.URL); err != nil || opEndpoint != "https://op.example.com/server" {
+		t.Errorf("Unexpected discovery: %s, %v", opEndpoint, err)
+	}
+}
+
+func TestDiscoverTooManyRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Limits.MaxRedirects = 3
+	_, _, _, err := oid.Discover(server.URL + "/")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.What != "redirects" || limitErr.Limit != 3 {
+		t.Fatalf("Expected a redirects LimitError, got %v", err)
+	}
+}
+
+func TestDiscoverNoRedirects(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Limits.MaxRedirects = -1
+	_, _, _, err := oid.Discover(server.URL + "/")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.What != "redirects" || limitErr.Limit != 0 {
+		t.Fatalf("Expected a redirects LimitError, got %v", err)
+	}
+}
+
+func TestDiscoverTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Limits.DiscoveryTimeout = 10 * time.Millisecond
+	_, _, _, err := oid.Discover(server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline error, got %v", err)
+	}
+}
+
+func TestVerifySignatureResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ns:http://specs.openid.net/auth/2.0\nis_valid:true\n"))
+		w.Write([]byte("padding:" + strings.Repeat("x", 100) + "\n"))
+	}))
+	defer server.Close()
+
+	vals := url.Values{"openid.op_endpoint": {server.URL}}
+	limits := &Limits{MaxKeyValueSize: 64}
+	err := verifySignature(context.Background(), vals, NewHTTPGetter(server.Client()), limits)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.What != "Key-Value response" {
+		t.Fatalf("Expected a LimitError, got %v", err)
+	}
+
+	limits.MaxKeyValueSize = 0
+	if err := verifySignature(context.Background(), vals, NewHTTPGetter(server.Client()), limits); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
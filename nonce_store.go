@@ -14,7 +14,8 @@ var maxNonceAge = flag.Duration("openid-max-nonce-age",
 		"memory is needed to store used nonces.")
 
 type NonceStore interface {
-	// Returns nil if accepted, an error otherwise.
+	// Returns nil if accepted, an error otherwise. Implementations
+	// should wrap ErrNonceReplayed and ErrNonceExpired.
 	Accept(endpoint, nonce string) error
 }
 
@@ -23,6 +24,12 @@ type Nonce struct {
 	S string
 }
 
+// String formats the nonce as an openid.response_nonce value: the
+// time, in UTC and without fractional seconds, followed by S.
+func (n *Nonce) String() string {
+	return n.T.UTC().Format(time.RFC3339) + n.S
+}
+
 type SimpleNonceStore struct {
 	store map[string][]*Nonce
 	mutex *sync.Mutex
@@ -55,7 +62,7 @@ func (d *SimpleNonceStore) Accept(endpoint, nonce string) error {
 	now := time.Now()
 	diff := now.Sub(ts)
 	if diff > *maxNonceAge {
-		return fmt.Errorf("Nonce too old: %.2fs", diff.Seconds())
+		return fmt.Errorf("%w: %.2fs", ErrNonceExpired, diff.Seconds())
 	}
 
 	s := nonce[20:]
@@ -73,7 +80,7 @@ func (d *SimpleNonceStore) Accept(endpoint, nonce string) error {
 			if n.T == ts && n.S == s {
 				// If return early, just ignore the filtered list
 				// we have been building so far...
-				return errors.New("Nonce already used")
+				return ErrNonceReplayed
 			}
 			if now.Sub(n.T) < *maxNonceAge {
 				newNonces = append(newNonces, n)
@@ -30,6 +30,13 @@ func TestDefaultNonceStore(t *testing.T) {
 	reject(t, ns, "3", now2mStr+"old") // too old
 }
 
+func TestNonceString(t *testing.T) {
+	n := &Nonce{T: time.Date(2005, 5, 15, 17, 11, 51, 500, time.FixedZone("X", 3600)), S: "UNIQUE"}
+	if s := n.String(); s != "2005-05-15T16:11:51ZUNIQUE" {
+		t.Errorf("Unexpected nonce string: %s", s)
+	}
+}
+
 func accept(t *testing.T, ns NonceStore, op, nonce string) {
 	e := ns.Accept(op, nonce)
 	if e != nil {
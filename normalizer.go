@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/url"
 	"strings"
+
+	"golang.org/x/net/idna"
 )
 
 func Normalize(id string) (string, error) {
@@ -35,8 +37,9 @@ func Normalize(id string) (string, error) {
 	// contains a fragment part, it MUST be stripped off together
 	// with the fragment delimiter character "#". See Section 11.5.2 for
 	// more information.
-	if !strings.HasPrefix(id, "http://") && !strings.HasPrefix(id,
-		"https://") {
+	// The scheme is case insensitive.
+	if lower := strings.ToLower(id); !strings.HasPrefix(lower, "http://") &&
+		!strings.HasPrefix(lower, "https://") {
 		id = "http://" + id
 	}
 	if fragmentIndex := strings.Index(id, "#"); fragmentIndex != -1 {
@@ -48,10 +51,10 @@ func Normalize(id string) (string, error) {
 		if u.Host == "" {
 			return "", errors.New("Invalid address provided as id")
 		}
-		if u.Path == "" {
-			u.Path = "/"
+		if u.Host, err = toASCIIHost(u.Host); err != nil {
+			return "", err
 		}
-		id = u.String()
+		id = normalizeURL(u)
 	}
 
 	// URL Identifiers MUST then be further normalized by both
@@ -62,3 +65,145 @@ func Normalize(id string) (string, error) {
 	// authentication.
 	return id, nil
 }
+
+// Converts an internationalized host name to its ASCII (punycode)
+// form, as per [RFC3987] section 3.1. The port, if any, is kept.
+func toASCIIHost(host string) (string, error) {
+	ascii := true
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return host, nil
+	}
+	port := ""
+	if i := strings.LastIndex(host, ":"); i != -1 && i > strings.LastIndex(host, "]") {
+		host, port = host[:i], host[i:]
+	}
+	host, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return host + port, nil
+}
+
+// Applies the syntax-based and scheme-based normalizations from
+// sections 6.2.2 and 6.2.3 of [RFC3986] to an http(s) URL:
+//   - scheme and host are lowercased,
+//   - percent-encodings use uppercase hexadecimal digits, and those of
+//     unreserved characters are decoded,
+//   - dot-segments are removed from the path,
+//   - the default port and an empty port are removed,
+//   - an empty path becomes "/".
+//
+// The fragment, if any, is dropped.
+func normalizeURL(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	// Careful with IPv6 literals: "[::1]:80".
+	if i := strings.LastIndex(host, ":"); i != -1 && i > strings.LastIndex(host, "]") {
+		if port := host[i+1:]; port == "" ||
+			(scheme == "http" && port == "80") ||
+			(scheme == "https" && port == "443") {
+			host = host[:i]
+		}
+	}
+
+	path := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+
+	result := scheme + "://"
+	if u.User != nil {
+		result += u.User.String() + "@"
+	}
+	result += host + path
+	if len(u.RawQuery) > 0 || u.ForceQuery {
+		result += "?" + normalizePercentEncoding(u.RawQuery)
+	}
+	return result
+}
+
+func normalizePercentEncoding(s string) string {
+	const upperhex = "0123456789ABCDEF"
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b = append(b, s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b = append(b, c)
+		} else {
+			b = append(b, '%', upperhex[c>>4], upperhex[c&15])
+		}
+		i += 2
+	}
+	return string(b)
+}
+
+// Section 5.2.4 of [RFC3986].
+func removeDotSegments(path string) string {
+	var out []string
+	for len(path) > 0 {
+		switch {
+		case strings.HasPrefix(path, "../"):
+			path = path[3:]
+		case strings.HasPrefix(path, "./"):
+			path = path[2:]
+		case strings.HasPrefix(path, "/./"):
+			path = path[2:]
+		case path == "/.":
+			path = "/"
+		case strings.HasPrefix(path, "/../"):
+			path = path[3:]
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		case path == "/..":
+			path = "/"
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		case path == "." || path == "..":
+			path = ""
+		default:
+			// Move the first path segment, including the initial "/"
+			// if any, to the output.
+			i := strings.Index(path[1:], "/")
+			if i == -1 {
+				out = append(out, path)
+				path = ""
+			} else {
+				out = append(out, path[:i+1])
+				path = path[i+1:]
+			}
+		}
+	}
+	return strings.Join(out, "")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// Section 2.3 of [RFC3986].
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -1,6 +1,7 @@
 package openid
 
 import (
+	"net/url"
 	"testing"
 )
 
@@ -41,6 +42,11 @@ func TestNormalize(t *testing.T) {
 	// Fragment need to be removed
 	doNormalize(t, "http://foo.com#bar", "http://foo.com/", true)
 	doNormalize(t, "http://foo.com/page#bar", "http://foo.com/page", true)
+
+	// RFC 3986 normalization, and IDN host names
+	doNormalize(t, "HTTP://Example.COM:80/a/../b", "http://example.com/b", true)
+	doNormalize(t, "http://bücher.example/", "http://xn--bcher-kva.example/", true)
+	doNormalize(t, "Bücher.Example:8080/a", "http://xn--bcher-kva.example:8080/a", true)
 }
 
 func doNormalize(t *testing.T, idIn, idOut string, succeed bool) {
@@ -52,3 +58,32 @@ func doNormalize(t *testing.T, idIn, idOut string, succeed bool) {
 		t.Errorf("unexpected normalize result: gave %v, expected %v, got %v", idIn, idOut, id)
 	}
 }
+
+func TestNormalizeURL(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"http://example.com", "http://example.com/"},
+		{"HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"http://example.com:80/", "http://example.com/"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"http://example.com:443/", "http://example.com:443/"},
+		{"http://example.com:8080/", "http://example.com:8080/"},
+		{"http://example.com:/", "http://example.com/"},
+		{"http://[::1]:80/", "http://[::1]/"},
+		{"http://example.com/a/./b/../c", "http://example.com/a/c"},
+		{"http://example.com/../../a", "http://example.com/a"},
+		{"http://example.com/a/..", "http://example.com/"},
+		{"http://example.com/%7euser/%2f%41", "http://example.com/~user/%2FA"},
+		{"http://example.com/?q=%3d%61", "http://example.com/?q=%3Da"},
+		{"http://user@example.com/", "http://user@example.com/"},
+		{"http://example.com/page#frag", "http://example.com/page"},
+	} {
+		u, err := url.Parse(c.in)
+		if err != nil {
+			t.Errorf("Could not parse %s: %s", c.in, err)
+			continue
+		}
+		if res := normalizeURL(u); res != c.out {
+			t.Errorf("unexpected normalizeURL result: gave %v, expected %v, got %v", c.in, c.out, res)
+		}
+	}
+}
@@ -1,15 +1,57 @@
 package openid
 
 import (
+	"net"
 	"net/http"
 )
 
 type OpenID struct {
-	urlGetter httpGetter
+	urlGetter HTTPGetter
+
+	// If YadisHead is true, Yadis discovery starts with a HEAD request,
+	// and only issues a GET if the response headers don't point to
+	// the XRDS document. This avoids downloading large HTML identity
+	// pages when the OP sends an X-XRDS-Location header.
+	YadisHead bool
+
+	// Limits bound the size of the fetched documents, the duration of
+	// discovery and verification, and the number of redirects.
+	Limits Limits
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// Forwarded and X-Forwarded-* headers are honored by RequestURL.
+	TrustedProxies []*net.IPNet
+
+	// Endpoints restricts the OPs used for discovery, redirections and
+	// verification.
+	Endpoints EndpointPolicy
+
+	// Providers are the well-known OPs of RedirectURLForProvider. If
+	// nil, DefaultProviders is used.
+	Providers *ProviderRegistry
+
+	// Unsolicited is the policy for unsolicited positive assertions,
+	// and UnsolicitedEndpoints the OP Endpoint URLs allowed by
+	// AllowlistUnsolicited.
+	Unsolicited          UnsolicitedPolicy
+	UnsolicitedEndpoints []string
+	// Solicitations records the requests of RedirectURLWithCache. If
+	// you run multiple servers, use a store shared between them.
+	Solicitations SolicitationStore
 }
 
 func NewOpenID(client *http.Client) *OpenID {
-	return &OpenID{urlGetter: &defaultGetter{client: client}}
+	return NewOpenIDWithGetter(NewHTTPGetter(client))
+}
+
+// NewOpenIDWithGetter returns an instance sending all its HTTP
+// requests with getter.
+func NewOpenIDWithGetter(getter HTTPGetter) *OpenID {
+	return &OpenID{
+		urlGetter:     getter,
+		Limits:        DefaultLimits(),
+		Solicitations: NewSimpleSolicitationStore(),
+	}
 }
 
 var defaultInstance = NewOpenID(http.DefaultClient)
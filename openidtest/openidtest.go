@@ -0,0 +1,258 @@
+// Package openidtest provides an in-process OpenID Provider, for
+// testing applications using openid-go without stubbing Verify.
+//
+// The Provider serves identity pages and XRDS documents for any
+// identity, and issues signed assertions that can be fed to
+// openid.Verify:
+//
+//	op := openidtest.NewProvider()
+//	defer op.Close()
+//	redirectURL, _ := openid.RedirectURL(op.IdentityURL("alice"), callbackURL, realm)
+//	callback, _ := op.Authenticate(redirectURL)
+//	id, err := openid.Verify(callback, discoveryCache, nonceStore)
+package openidtest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/yohcop/openid-go"
+	"github.com/yohcop/openid-go/provider"
+	"golang.org/x/net/html"
+)
+
+// Outcome of the authentication requests sent to the Provider.
+type Outcome int
+
+const (
+	// Allow: a valid positive assertion is sent back.
+	Allow Outcome = iota
+	// Cancel: the end user cancelled the authentication.
+	Cancel
+	// SetupNeeded: the OP answers as if the request was
+	// checkid_immediate and required interacting with the end user.
+	SetupNeeded
+	// Tampered: a positive assertion is sent back, but its claimed
+	// identifier was modified after signing. Verify must reject it.
+	Tampered
+)
+
+// Provider is an OpenID Provider running on a local httptest.Server.
+// Its OP Endpoint URL is also an OP Identifier.
+type Provider struct {
+	Server *httptest.Server
+	OP     *provider.Provider
+
+	mutex    *sync.Mutex
+	identity string
+	outcome  Outcome
+}
+
+// NewProvider starts a Provider. It must be closed with Close. By
+// default, it allows all authentication requests, and asserts the
+// identity "user" when the Relying Party lets the OP choose.
+func NewProvider() *Provider {
+	mux := http.NewServeMux()
+	p := &Provider{
+		Server:   httptest.NewServer(mux),
+		mutex:    &sync.Mutex{},
+		identity: "user",
+		outcome:  Allow,
+	}
+	p.OP = provider.NewProvider(p.Endpoint(), p.decide)
+	// Allow associations without TLS: this is a local test server.
+	p.OP.AllowNoEncryption = true
+
+	mux.Handle("/op", p.OP)
+	mux.HandleFunc("/id/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/id/")
+		page := &openid.IdentityPage{
+			OpEndpoint:   p.Endpoint(),
+			XrdsLocation: p.Server.URL + "/xrds/" + name,
+			Title:        name,
+		}
+		page.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/xrds/", func(w http.ResponseWriter, r *http.Request) {
+		openid.NewClaimedIdentifierXrds(p.Endpoint(), "").ServeHTTP(w, r)
+	})
+	return p
+}
+
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Endpoint returns the OP Endpoint URL.
+func (p *Provider) Endpoint() string {
+	return p.Server.URL + "/op"
+}
+
+// ProviderInfo returns the description of the Provider to register in
+// an openid.ProviderRegistry, with this name.
+func (p *Provider) ProviderInfo(name string) *openid.ProviderInfo {
+	return &openid.ProviderInfo{
+		Name:         name,
+		DisplayName:  "openidtest",
+		OPIdentifier: p.Endpoint(),
+	}
+}
+
+// IdentityURL returns the Claimed Identifier of the end user name.
+func (p *Provider) IdentityURL(name string) string {
+	return p.Server.URL + "/id/" + name
+}
+
+// SetIdentity sets the end user asserted when the Relying Party lets
+// the OP choose the identifier.
+func (p *Provider) SetIdentity(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.identity = name
+}
+
+// SetOutcome sets the outcome of the following authentication
+// requests.
+func (p *Provider) SetOutcome(o Outcome) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.outcome = o
+}
+
+func (p *Provider) settings() (identity string, outcome Outcome) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.identity, p.outcome
+}
+
+func (p *Provider) decide(w http.ResponseWriter, r *http.Request, req *provider.AuthRequest) provider.Decision {
+	identity, outcome := p.settings()
+	if outcome == Cancel || outcome == SetupNeeded {
+		return provider.Decision{Outcome: provider.Deny}
+	}
+	d := provider.Decision{Outcome: provider.Allow}
+	if req.IdentifierSelect() {
+		d.ClaimedID = p.IdentityURL(identity)
+	}
+	return d
+}
+
+// Authenticate plays the part of the end user's browser: it sends the
+// authentication request redirectURL, as returned by
+// openid.RedirectURL, to the Provider, and returns the URL the end
+// user is sent back to. This is the URL to pass to openid.Verify. If
+// the assertion is too long for a redirect and POSTed with a form
+// instead, the form fields are added to the query of the returned URL.
+func (p *Provider) Authenticate(redirectURL string) (string, error) {
+	_, outcome := p.settings()
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", err
+	}
+	if outcome == SetupNeeded {
+		q := u.Query()
+		q.Set("openid.mode", "checkid_immediate")
+		u.RawQuery = q.Encode()
+	}
+
+	client := *p.Server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	callback := resp.Header.Get("Location")
+	if len(callback) == 0 && resp.StatusCode == http.StatusOK {
+		// Long assertions are POSTed with a form (see openid.Redirect).
+		callback, err = formCallback(resp.Body)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(callback) == 0 {
+		return "", errors.New("The provider did not redirect: " + resp.Status)
+	}
+	if outcome == Tampered {
+		return tamper(callback)
+	}
+	return callback, nil
+}
+
+// Assertion returns the URL of an assertion about the end user name,
+// sent to returnTo, as if the Relying Party had discovered
+// IdentityURL(name).
+func (p *Provider) Assertion(name, returnTo string) (string, error) {
+	redirectURL, err := openid.BuildRedirectURL(p.Endpoint(), "", p.IdentityURL(name), returnTo, "")
+	if err != nil {
+		return "", err
+	}
+	return p.Authenticate(redirectURL)
+}
+
+// Returns the action of the auto-submitting form in body, with the
+// values of its fields added to its query.
+func formCallback(body io.Reader) (string, error) {
+	var action *url.URL
+	values := make(url.Values)
+	tokenizer := html.NewTokenizer(body)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tk := tokenizer.Token()
+		attrs := map[string]string{}
+		for _, attr := range tk.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+		if tk.Data == "form" && action == nil {
+			u, err := url.Parse(attrs["action"])
+			if err != nil {
+				return "", err
+			}
+			action = u
+		} else if tk.Data == "input" && attrs["type"] == "hidden" {
+			values.Add(attrs["name"], attrs["value"])
+		}
+	}
+	if err := tokenizer.Err(); err != io.EOF {
+		return "", err
+	}
+	if action == nil {
+		return "", nil
+	}
+	query := action.Query()
+	for k, vs := range values {
+		query[k] = vs
+	}
+	action.RawQuery = query.Encode()
+	return action.String(), nil
+}
+
+// Changes the identifiers of a positive assertion, which invalidates
+// its signature.
+func tamper(callback string) (string, error) {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if q.Get("openid.mode") != "id_res" {
+		return callback, nil
+	}
+	q.Set("openid.claimed_id", q.Get("openid.claimed_id")+"-tampered")
+	q.Set("openid.identity", q.Get("openid.identity")+"-tampered")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,250 @@
+package openidtest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/yohcop/openid-go"
+)
+
+const returnTo = "http://rp.example.com/openid/callback"
+
+func verify(callback string) (string, error) {
+	return openid.Verify(callback, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore())
+}
+
+func TestAllow(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+
+	redirectURL, err := openid.RedirectURL(op.IdentityURL("alice"), returnTo, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	callback, err := op.Authenticate(redirectURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	id, err := verify(callback)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if id != op.IdentityURL("alice") {
+		t.Errorf("Unexpected identity: %s", id)
+	}
+}
+
+func TestLongAssertion(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+
+	longReturnTo := returnTo + "?state=" + strings.Repeat("x", openid.MaxRedirectURLLength)
+	callback, err := op.Assertion("alice", longReturnTo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	id, err := verify(callback)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if id != op.IdentityURL("alice") {
+		t.Errorf("Unexpected identity: %s", id)
+	}
+}
+
+func TestIdentifierSelect(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+	op.SetIdentity("bob")
+
+	redirectURL, err := openid.RedirectURL(op.Endpoint(), returnTo, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	callback, err := op.Authenticate(redirectURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if id, err := verify(callback); err != nil || id != op.IdentityURL("bob") {
+		t.Errorf("Unexpected Verify result: %s, %v", id, err)
+	}
+}
+
+func TestNegativeOutcomes(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+
+	for outcome, mode := range map[Outcome]string{
+		Cancel:      "cancel",
+		SetupNeeded: "setup_needed",
+		Tampered:    "id_res",
+	} {
+		op.SetOutcome(outcome)
+		callback, err := op.Assertion("alice", returnTo)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		u, _ := url.Parse(callback)
+		if m := u.Query().Get("openid.mode"); m != mode {
+			t.Errorf("Expected mode %s, got %s", mode, m)
+		}
+		if id, err := verify(callback); err == nil {
+			t.Errorf("Verify succeeded for outcome %v: %s", outcome, id)
+		}
+	}
+}
+
+func TestRelyingParty(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+
+	mux := http.NewServeMux()
+	rpServer := httptest.NewServer(mux)
+	defer rpServer.Close()
+	var failure error
+	rp, err := openid.NewRelyingParty(rpServer.URL+"/openid/callback", rpServer.URL+"/",
+		func(w http.ResponseWriter, r *http.Request, id string) {
+			w.Write([]byte(id))
+		})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	rp.Failure = func(w http.ResponseWriter, r *http.Request, err error) {
+		failure = err
+		http.Error(w, "failed", http.StatusForbidden)
+	}
+	mux.Handle("/openid/", rp)
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	noRedirect := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	login := func() string {
+		resp, err := noRedirect.PostForm(rpServer.URL+"/openid/login",
+			url.Values{"openid_identifier": {op.IdentityURL("alice")}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("Expected a redirect, got %s", resp.Status)
+		}
+		callback, err := op.Authenticate(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resp, err = browser.Get(callback)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if id := login(); id != op.IdentityURL("alice") || failure != nil {
+		t.Errorf("Unexpected login: %s, %v", id, failure)
+	}
+
+	op.SetOutcome(Cancel)
+	login()
+	if !errors.Is(failure, openid.ErrCanceled) {
+		t.Errorf("Expected a canceled authentication, got %v", failure)
+	}
+
+	// Without transactions, logins are solicited through the
+	// discovery cache.
+	op.SetOutcome(Allow)
+	failure = nil
+	rp.OpenID = openid.NewOpenID(nil)
+	rp.OpenID.Unsolicited = openid.RejectUnsolicited
+	rp.Transactions = nil
+	if id := login(); id != op.IdentityURL("alice") || failure != nil {
+		t.Errorf("Unexpected login: %s, %v", id, failure)
+	}
+}
+
+func TestRejectUnsolicited(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+	oid := openid.NewOpenID(op.Server.Client())
+	oid.Unsolicited = openid.RejectUnsolicited
+
+	cache := openid.NewSimpleDiscoveryCache()
+	redirectURL, err := oid.RedirectURLWithCache(context.Background(), op.IdentityURL("alice"), returnTo, "", cache)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	callback, err := op.Authenticate(redirectURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	id, err := oid.Verify(callback, cache, openid.NewSimpleNonceStore())
+	if err != nil || id != op.IdentityURL("alice") {
+		t.Errorf("Unexpected Verify result: %s, %v", id, err)
+	}
+
+	// Nothing tells that these were requested, even for an end user
+	// who logged in before.
+	for _, name := range []string{"bob", "alice"} {
+		callback, err = op.Assertion(name, returnTo)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err = oid.Verify(callback, cache, openid.NewSimpleNonceStore()); !errors.Is(err, openid.ErrUnsolicited) {
+			t.Errorf("%s: expected an unsolicited assertion, got %v", name, err)
+		}
+	}
+}
+
+func TestRedirectURLForProvider(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+	op.SetIdentity("carol")
+
+	oid := openid.NewOpenID(op.Server.Client())
+	oid.Providers = openid.NewProviderRegistry(op.ProviderInfo("fake"))
+	redirectURL, err := oid.RedirectURLForProvider("fake", returnTo, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	callback, err := op.Authenticate(redirectURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	id, err := oid.Verify(callback, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore())
+	if err != nil || id != op.IdentityURL("carol") {
+		t.Errorf("Unexpected Verify result: %s, %v", id, err)
+	}
+}
+
+func TestStartTransactionForProvider(t *testing.T) {
+	op := NewProvider()
+	defer op.Close()
+	op.SetIdentity("carol")
+
+	oid := openid.NewOpenID(op.Server.Client())
+	oid.Providers = openid.NewProviderRegistry(op.ProviderInfo("fake"))
+	oid.Unsolicited = openid.RejectUnsolicited
+	tx, redirectURL, err := oid.StartTransactionForProvider(context.Background(), "fake", returnTo, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	callback, err := op.Authenticate(redirectURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	id, err := oid.VerifyTransaction(httptest.NewRequest("GET", callback, nil), tx,
+		openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore())
+	if err != nil || id != op.IdentityURL("carol") {
+		t.Errorf("Unexpected VerifyTransaction result: %s, %v", id, err)
+	}
+}
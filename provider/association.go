@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yohcop/openid-go"
+)
+
+// An Association is a secret shared between the OP and a Relying
+// Party (or kept by the OP only, for private associations), used to
+// sign assertions.
+type Association struct {
+	Handle string
+	// Type is "HMAC-SHA1" or "HMAC-SHA256".
+	Type    string
+	Secret  []byte
+	Expires time.Time
+	// Private associations are never shared with a Relying Party.
+	// Signatures made with them are checked by the OP, with
+	// check_authentication.
+	Private bool
+}
+
+type AssociationStore interface {
+	Put(assoc *Association)
+	// Returns the association with this handle, or nil if it does
+	// not exist or has expired.
+	Get(handle string) *Association
+	Delete(handle string)
+}
+
+func hashForType(assocType string) func() hash.Hash {
+	switch assocType {
+	case "HMAC-SHA1":
+		return sha1.New
+	case "HMAC-SHA256":
+		return sha256.New
+	}
+	return nil
+}
+
+func newAssociation(assocType string, lifetime time.Duration, private bool) (*Association, error) {
+	h := hashForType(assocType)
+	if h == nil {
+		return nil, errors.New("Unsupported association type: " + assocType)
+	}
+	secret := make([]byte, h().Size())
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	// The handle MUST be 255 characters or less, and consist only of
+	// ASCII characters in the range 33-126 inclusive.
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Association{
+		Handle:  strconv.FormatInt(now.Unix(), 10) + "." + hex.EncodeToString(random),
+		Type:    assocType,
+		Secret:  secret,
+		Expires: now.Add(lifetime),
+		Private: private,
+	}, nil
+}
+
+// 6.  Generating Signatures
+// Sign returns the base64 encoded signature of the signed fields of
+// vals (listed without the "openid." prefix, as in openid.signed).
+func (a *Association) Sign(vals url.Values, signed []string) (string, error) {
+	mac, err := a.mac(vals, signed)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(mac), nil
+}
+
+// Verify returns true if sig is the signature of the signed fields of
+// vals.
+func (a *Association) Verify(vals url.Values, signed []string, sig string) bool {
+	expected, err := a.mac(vals, signed)
+	if err != nil {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, decoded)
+}
+
+// 6.1.  Signature Algorithm
+// The message is the Key-Value form encoding of the signed fields, in
+// the order of openid.signed.
+func (a *Association) mac(vals url.Values, signed []string) ([]byte, error) {
+	h := hashForType(a.Type)
+	if h == nil {
+		return nil, errors.New("Unsupported association type: " + a.Type)
+	}
+	kv := make(map[string]string, len(signed))
+	for _, k := range signed {
+		kv[k] = vals.Get("openid." + k)
+	}
+	msg, err := openid.EncodeKeyValueForm(signed, kv)
+	if err != nil {
+		return nil, err
+	}
+	m := hmac.New(h, a.Secret)
+	m.Write(msg)
+	return m.Sum(nil), nil
+}
+
+// SimpleAssociationStore is an in-memory AssociationStore. Expired
+// associations are removed at most once a minute, when a new one is
+// stored.
+type SimpleAssociationStore struct {
+	store     map[string]*Association
+	mutex     *sync.Mutex
+	lastSweep time.Time
+}
+
+func NewSimpleAssociationStore() *SimpleAssociationStore {
+	return &SimpleAssociationStore{store: map[string]*Association{}, mutex: &sync.Mutex{}}
+}
+
+func (s *SimpleAssociationStore) Put(assoc *Association) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for handle, a := range s.store {
+			if !now.Before(a.Expires) {
+				delete(s.store, handle)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.store[assoc.Handle] = assoc
+}
+
+func (s *SimpleAssociationStore) Get(handle string) *Association {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if assoc, has := s.store[handle]; has {
+		if time.Now().Before(assoc.Expires) {
+			return assoc
+		}
+		delete(s.store, handle)
+	}
+	return nil
+}
+
+func (s *SimpleAssociationStore) Delete(handle string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.store, handle)
+}
+
+// Generates an openid.response_nonce: the current time followed by
+// random printable characters.
+func newNonce() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	n := &openid.Nonce{T: time.Now(), S: hex.EncodeToString(random)}
+	return n.String(), nil
+}
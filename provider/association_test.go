@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAssociationSignature(t *testing.T) {
+	for _, assocType := range []string{"HMAC-SHA1", "HMAC-SHA256"} {
+		assoc, err := newAssociation(assocType, time.Minute, false)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		vals := url.Values{
+			"openid.mode":      {"id_res"},
+			"openid.return_to": {"http://rp.example.com/"},
+			"openid.other":     {"not signed"},
+		}
+		signed := []string{"mode", "return_to"}
+		sig, err := assoc.Sign(vals, signed)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if !assoc.Verify(vals, signed, sig) {
+			t.Errorf("%s: signature does not verify", assocType)
+		}
+
+		vals.Set("openid.other", "changed")
+		if !assoc.Verify(vals, signed, sig) {
+			t.Errorf("%s: unsigned field changes the signature", assocType)
+		}
+		vals.Set("openid.return_to", "http://evil.example.com/")
+		if assoc.Verify(vals, signed, sig) {
+			t.Errorf("%s: signature verifies a modified field", assocType)
+		}
+	}
+}
+
+func TestSimpleAssociationStore(t *testing.T) {
+	s := NewSimpleAssociationStore()
+	s.Put(&Association{Handle: "valid", Expires: time.Now().Add(time.Minute)})
+	s.Put(&Association{Handle: "expired", Expires: time.Now().Add(-time.Minute)})
+
+	if a := s.Get("valid"); a == nil {
+		t.Errorf("Expected an association, got nil")
+	}
+	if a := s.Get("expired"); a != nil {
+		t.Errorf("Expected nil for an expired association, got %v", a)
+	}
+	s.Delete("valid")
+	if a := s.Get("valid"); a != nil {
+		t.Errorf("Expected nil for a deleted association, got %v", a)
+	}
+}
+
+func TestSimpleAssociationStoreSweep(t *testing.T) {
+	s := NewSimpleAssociationStore()
+	s.Put(&Association{Handle: "expired", Expires: time.Now().Add(-time.Minute)})
+	s.lastSweep = time.Now().Add(-2 * time.Minute)
+	s.Put(&Association{Handle: "valid", Expires: time.Now().Add(time.Minute)})
+	if _, has := s.store["expired"]; has {
+		t.Errorf("Expired association not removed")
+	}
+	if _, has := s.store["valid"]; !has {
+		t.Errorf("Valid association removed")
+	}
+}
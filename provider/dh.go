@@ -0,0 +1,168 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// 8.1.2.  Diffie-Hellman Request Parameters
+// Default modulus and generator, from Appendix B.
+var (
+	defaultModulus, _ = new(big.Int).SetString(
+		"DCF93A0B883972EC0E19989AC5A2CE310E1D37717E8D9571BB7623731866E61E"+
+			"F75A2E27898B057F9891C2E27A639C3F29B60814581CD3B2CA3986D268370557"+
+			"7D45C2E7E52DC81C7A171876E5CEA74B1448BFDFAF18828EFD2519F14E45E382"+
+			"6634AF1949E5B535CC829A483B8A76223E5D490A257F05BDFF16F2FB22C583AB", 16)
+	defaultGenerator = big.NewInt(2)
+)
+
+// Larger moduli sent by Relying Parties are refused: the exchange
+// costs two modular exponentiations, growing steeply with their size.
+const maxModulusBits = 4096
+
+// 4.2.  Integer Representations
+// Arbitrary precision integers are encoded as big-endian signed two's
+// complement binary strings ("btwoc").
+func btwoc(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func decodeBtwoc(s string) (*big.Int, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Session types, with the hash function used to encrypt the MAC key,
+// and the association type they must be used with.
+var sessionTypes = map[string]struct {
+	hash      func() hash.Hash
+	assocType string
+}{
+	"no-encryption": {nil, ""},
+	"DH-SHA1":       {sha1.New, "HMAC-SHA1"},
+	"DH-SHA256":     {sha256.New, "HMAC-SHA256"},
+}
+
+// 8.  Establishing Associations
+func (p *Provider) associate(w http.ResponseWriter, r *http.Request, vals url.Values) {
+	assocType := vals.Get("openid.assoc_type")
+	sessionType := vals.Get("openid.session_type")
+	session, ok := sessionTypes[sessionType]
+	supported := ok && hashForType(assocType) != nil &&
+		(session.assocType == "" || session.assocType == assocType) &&
+		// 8.4.1: no-encryption MUST NOT be used without transport
+		// layer encryption.
+		(session.hash != nil || r.TLS != nil || p.AllowNoEncryption)
+	if !supported {
+		// 8.2.4.  Unsuccessful Response Parameters
+		writeDirectResponse(w, http.StatusBadRequest,
+			[]string{"ns", "error", "error_code", "session_type", "assoc_type"},
+			map[string]string{
+				"ns":           nsOpenID2,
+				"error":        "Unsupported association or session type",
+				"error_code":   "unsupported-type",
+				"session_type": "DH-SHA256",
+				"assoc_type":   "HMAC-SHA256",
+			})
+		return
+	}
+
+	assoc, err := newAssociation(assocType, p.AssociationLifetime, false)
+	if err != nil {
+		writeDirectError(w, err.Error(), "")
+		return
+	}
+
+	// 8.2.1.  Common Response Parameters
+	keys := []string{"ns", "assoc_handle", "session_type", "assoc_type", "expires_in"}
+	response := map[string]string{
+		"ns":           nsOpenID2,
+		"assoc_handle": assoc.Handle,
+		"session_type": sessionType,
+		"assoc_type":   assocType,
+		"expires_in":   strconv.FormatInt(int64(p.AssociationLifetime.Seconds()), 10),
+	}
+	if session.hash == nil {
+		// 8.2.2.  Unencrypted Response Parameters
+		keys = append(keys, "mac_key")
+		response["mac_key"] = base64.StdEncoding.EncodeToString(assoc.Secret)
+	} else {
+		// 8.2.3.  Diffie-Hellman Response Parameters
+		serverPublic, encMacKey, err := dhExchange(vals, session.hash, assoc.Secret)
+		if err != nil {
+			writeDirectError(w, err.Error(), "")
+			return
+		}
+		keys = append(keys, "dh_server_public", "enc_mac_key")
+		response["dh_server_public"] = base64.StdEncoding.EncodeToString(btwoc(serverPublic))
+		response["enc_mac_key"] = base64.StdEncoding.EncodeToString(encMacKey)
+	}
+	p.Associations.Put(assoc)
+	writeDirectResponse(w, http.StatusOK, keys, response)
+}
+
+// 8.4.2.  Diffie-Hellman Key Exchange
+// Returns the OP's public key g ^ xb mod p, and the MAC key encrypted
+// with the shared secret: H(btwoc(g ^ (xa * xb) mod p)) XOR MAC key.
+func dhExchange(vals url.Values, h func() hash.Hash, macKey []byte) (serverPublic *big.Int, encMacKey []byte, err error) {
+	modulus, generator := defaultModulus, defaultGenerator
+	if m := vals.Get("openid.dh_modulus"); len(m) > 0 {
+		if modulus, err = decodeBtwoc(m); err != nil {
+			return nil, nil, err
+		}
+	}
+	if g := vals.Get("openid.dh_gen"); len(g) > 0 {
+		if generator, err = decodeBtwoc(g); err != nil {
+			return nil, nil, err
+		}
+	}
+	consumerPublic, err := decodeBtwoc(vals.Get("openid.dh_consumer_public"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if modulus.BitLen() > maxModulusBits {
+		return nil, nil, errors.New("Diffie-Hellman modulus too large")
+	}
+	one := big.NewInt(1)
+	if modulus.Cmp(big.NewInt(3)) < 0 || generator.Cmp(one) <= 0 ||
+		generator.Cmp(modulus) >= 0 ||
+		consumerPublic.Cmp(one) <= 0 ||
+		consumerPublic.Cmp(new(big.Int).Sub(modulus, one)) >= 0 {
+		return nil, nil, errors.New("Invalid Diffie-Hellman parameters")
+	}
+	if len(macKey) != h().Size() {
+		return nil, nil, errors.New("MAC key size does not match the session type")
+	}
+
+	// Private key in [1, p-2].
+	private, err := rand.Int(rand.Reader, new(big.Int).Sub(modulus, big.NewInt(2)))
+	if err != nil {
+		return nil, nil, err
+	}
+	private.Add(private, one)
+
+	serverPublic = new(big.Int).Exp(generator, private, modulus)
+	shared := new(big.Int).Exp(consumerPublic, private, modulus)
+	hs := h()
+	hs.Write(btwoc(shared))
+	encMacKey = hs.Sum(nil)
+	for i := range encMacKey {
+		encMacKey[i] ^= macKey[i]
+	}
+	return serverPublic, encMacKey, nil
+}
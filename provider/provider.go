@@ -0,0 +1,409 @@
+// Package provider implements the OpenID Provider (OP) side of
+// OpenID Authentication 2.0.
+//
+// A Provider is an http.Handler to be served at the OP Endpoint URL.
+// It handles association requests, authentication requests
+// (checkid_setup and checkid_immediate) and direct verification of
+// signatures (check_authentication). Whether the end user authorizes
+// an authentication request is decided by the application, with a
+// DecisionFunc.
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yohcop/openid-go"
+)
+
+const (
+	nsOpenID2        = "http://specs.openid.net/auth/2.0"
+	identifierSelect = "http://specs.openid.net/auth/2.0/identifier_select"
+)
+
+// Outcome of an authentication request.
+type Outcome int
+
+const (
+	// Deny: the end user did not authorize the request. A negative
+	// assertion is sent to the Relying Party.
+	Deny Outcome = iota
+	// Allow: a positive assertion is sent to the Relying Party.
+	Allow
+	// Pending: the DecisionFunc handled the HTTP request itself, for
+	// example to render a login page. The application is expected to
+	// call Provider.Respond once the end user made a decision.
+	Pending
+)
+
+// Decision of the application about an authentication request.
+type Decision struct {
+	Outcome Outcome
+	// The identifiers to assert when the outcome is Allow. They are
+	// required if the Relying Party let the OP choose the identifier,
+	// and default to the ones of the request otherwise. Identity
+	// defaults to ClaimedID.
+	ClaimedID string
+	Identity  string
+	// Extension fields to add to a positive assertion, without the
+	// "openid." prefix (e.g. "ns.sreg", "sreg.email"). They are all
+	// signed, and must be in a namespace declared here (see
+	// openid.CheckExtensionKeys).
+	Extensions map[string]string
+}
+
+// A DecisionFunc decides whether the end user authorizes an
+// authentication request. r is the HTTP request carrying it.
+type DecisionFunc func(w http.ResponseWriter, r *http.Request, req *AuthRequest) Decision
+
+// AuthRequest is a checkid_setup or checkid_immediate request.
+type AuthRequest struct {
+	// Immediate is true for checkid_immediate requests, where the OP
+	// must not interact with the end user.
+	Immediate bool
+	// Claimed Identifier and OP-Local Identifier the Relying Party
+	// wants to verify. They are both identifier_select if the Relying
+	// Party lets the OP choose (see IdentifierSelect).
+	ClaimedID string
+	Identity  string
+	ReturnTo  string
+	// Realm is the openid.realm, or the return_to URL if the Relying
+	// Party did not send one.
+	Realm       string
+	AssocHandle string
+	// Values holds all the request fields, including extensions.
+	Values url.Values
+}
+
+// IdentifierSelect returns true if the Relying Party lets the OP
+// choose the identifier of the end user.
+func (req *AuthRequest) IdentifierSelect() bool {
+	return req.Identity == identifierSelect
+}
+
+// ParseAuthRequest parses and validates the fields of an
+// authentication request (section 9.1). It can be used to resume a
+// request previously left Pending.
+func ParseAuthRequest(vals url.Values) (*AuthRequest, error) {
+	req := &AuthRequest{
+		ClaimedID:   vals.Get("openid.claimed_id"),
+		Identity:    vals.Get("openid.identity"),
+		ReturnTo:    vals.Get("openid.return_to"),
+		Realm:       vals.Get("openid.realm"),
+		AssocHandle: vals.Get("openid.assoc_handle"),
+		Values:      vals,
+	}
+	if vals.Get("openid.ns") != nsOpenID2 {
+		return nil, errors.New("Only OpenID 2.0 is supported")
+	}
+	switch vals.Get("openid.mode") {
+	case "checkid_setup":
+	case "checkid_immediate":
+		req.Immediate = true
+	default:
+		return nil, errors.New("Not an authentication request")
+	}
+	// "openid.claimed_id" and "openid.identity" SHALL be either both
+	// present or both absent.
+	if (len(req.ClaimedID) == 0) != (len(req.Identity) == 0) {
+		return nil, errors.New("openid.claimed_id and openid.identity must be both present or absent")
+	}
+	// This implementation only answers requests about identifiers:
+	// without a return_to URL, we could not send the assertion back.
+	if len(req.Identity) == 0 {
+		return nil, errors.New("Requests without an identifier are not supported")
+	}
+	if len(req.ReturnTo) == 0 {
+		return nil, errors.New("Missing openid.return_to")
+	}
+	if len(req.Realm) == 0 {
+		// 9.1: If openid.realm is not sent, the return_to URL is used.
+		req.Realm = req.ReturnTo
+	}
+	realm, err := openid.ParseRealm(req.Realm)
+	if err != nil {
+		return nil, err
+	}
+	if !realm.Matches(req.ReturnTo) {
+		return nil, errors.New("openid.return_to is not within openid.realm")
+	}
+	return req, nil
+}
+
+// Provider is an OpenID Provider, served at the OP Endpoint URL.
+type Provider struct {
+	// Endpoint is the OP Endpoint URL, as advertised during discovery.
+	Endpoint string
+	Decide   DecisionFunc
+	// Associations stores both shared associations (established with
+	// Relying Parties) and private ones (used in stateless mode).
+	Associations AssociationStore
+	// Nonces makes sure a signature is verified at most once with
+	// check_authentication.
+	Nonces              openid.NonceStore
+	AssociationLifetime time.Duration
+	// Association sessions with no encryption of the MAC key are only
+	// accepted over TLS. Set AllowNoEncryption if TLS is terminated
+	// before reaching this handler.
+	AllowNoEncryption bool
+}
+
+// NewProvider returns a Provider with in-memory association and
+// nonce stores. If you run multiple OP servers, use stores shared
+// between them instead.
+func NewProvider(endpoint string, decide DecisionFunc) *Provider {
+	return &Provider{
+		Endpoint:            endpoint,
+		Decide:              decide,
+		Associations:        NewSimpleAssociationStore(),
+		Nonces:              openid.NewSimpleNonceStore(),
+		AssociationLifetime: 24 * time.Hour,
+	}
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeDirectError(w, err.Error(), "")
+		return
+	}
+	vals := r.Form
+	switch mode := vals.Get("openid.mode"); mode {
+	case "associate", "check_authentication":
+		// 5.1.1: Direct requests are sent with HTTP POST.
+		if r.Method != "POST" {
+			writeDirectError(w, "Direct requests must use POST", "")
+			return
+		}
+		if vals.Get("openid.ns") != nsOpenID2 {
+			writeDirectError(w, "Only OpenID 2.0 is supported", "")
+			return
+		}
+		if mode == "associate" {
+			p.associate(w, r, vals)
+		} else {
+			p.checkAuthentication(w, vals)
+		}
+	case "checkid_setup", "checkid_immediate":
+		req, err := ParseAuthRequest(vals)
+		if err != nil {
+			writeIndirectError(w, r, vals.Get("openid.return_to"), err.Error())
+			return
+		}
+		p.Respond(w, r, req, p.Decide(w, r, req))
+	case "":
+		// Not an OpenID request: the OP Endpoint URL is also an OP
+		// Identifier, so that Relying Parties can use it to start an
+		// identifier_select authentication.
+		openid.NewOPIdentifierXrds(p.Endpoint).ServeHTTP(w, r)
+	default:
+		writeDirectError(w, "Unknown openid.mode", "")
+	}
+}
+
+// Respond sends the response to an authentication request to the
+// Relying Party, by redirecting the end user to the return_to URL.
+func (p *Provider) Respond(w http.ResponseWriter, r *http.Request, req *AuthRequest, d Decision) {
+	switch d.Outcome {
+	case Pending:
+		return
+	case Allow:
+		vals, err := p.positiveAssertion(req, d)
+		if err != nil {
+			writeIndirectError(w, r, req.ReturnTo, err.Error())
+			return
+		}
+		redirect(w, r, req.ReturnTo, vals)
+	default:
+		// 10.2.  Negative Assertions
+		vals := url.Values{"openid.ns": {nsOpenID2}}
+		if req.Immediate {
+			vals.Set("openid.mode", "setup_needed")
+		} else {
+			vals.Set("openid.mode", "cancel")
+		}
+		redirect(w, r, req.ReturnTo, vals)
+	}
+}
+
+// 10.1.  Positive Assertions
+func (p *Provider) positiveAssertion(req *AuthRequest, d Decision) (url.Values, error) {
+	claimedID, identity := req.ClaimedID, req.Identity
+	if len(d.ClaimedID) > 0 {
+		claimedID, identity = d.ClaimedID, d.Identity
+		if len(identity) == 0 {
+			identity = claimedID
+		}
+	}
+	if claimedID == identifierSelect || identity == identifierSelect {
+		return nil, errors.New("No identifier selected")
+	}
+
+	var extensions []string
+	for k := range d.Extensions {
+		extensions = append(extensions, k)
+	}
+	sort.Strings(extensions)
+	if err := openid.CheckExtensionKeys(extensions); err != nil {
+		return nil, err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	assoc, invalidateHandle, err := p.signingAssociation(req.AssocHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := url.Values{}
+	vals.Set("openid.ns", nsOpenID2)
+	vals.Set("openid.mode", "id_res")
+	vals.Set("openid.op_endpoint", p.Endpoint)
+	vals.Set("openid.claimed_id", claimedID)
+	vals.Set("openid.identity", identity)
+	vals.Set("openid.return_to", req.ReturnTo)
+	vals.Set("openid.response_nonce", nonce)
+	vals.Set("openid.assoc_handle", assoc.Handle)
+	if len(invalidateHandle) > 0 {
+		vals.Set("openid.invalidate_handle", invalidateHandle)
+	}
+
+	// This list MUST contain at least "op_endpoint", "return_to"
+	// "response_nonce" and "assoc_handle", and if present in the
+	// response, "claimed_id" and "identity".
+	signed := []string{"op_endpoint", "claimed_id", "identity",
+		"return_to", "response_nonce", "assoc_handle"}
+	for _, k := range extensions {
+		vals.Set("openid."+k, d.Extensions[k])
+	}
+	signed = append(signed, extensions...)
+	vals.Set("openid.signed", strings.Join(signed, ","))
+
+	sig, err := assoc.Sign(vals, signed)
+	if err != nil {
+		return nil, err
+	}
+	vals.Set("openid.sig", sig)
+	return vals, nil
+}
+
+// Private associations sign a single assertion, which the Relying
+// Party verifies right after receiving it.
+const privateAssociationLifetime = 5 * time.Minute
+
+// Returns the association to sign an assertion with: the shared
+// association the Relying Party asked for if it is still valid, or a
+// new private association. In the latter case, the handle requested
+// by the Relying Party is returned so it can be invalidated.
+func (p *Provider) signingAssociation(handle string) (assoc *Association, invalidateHandle string, err error) {
+	if len(handle) > 0 {
+		if assoc = p.Associations.Get(handle); assoc != nil && !assoc.Private {
+			return assoc, "", nil
+		}
+		invalidateHandle = handle
+	}
+	// 11.4.2: When the Relying Party did not establish an association,
+	// the OP uses a private association, and the Relying Party checks
+	// the signature with check_authentication.
+	assoc, err = newAssociation("HMAC-SHA256", privateAssociationLifetime, true)
+	if err != nil {
+		return nil, "", err
+	}
+	p.Associations.Put(assoc)
+	return assoc, invalidateHandle, nil
+}
+
+// 11.4.2.2.  Response Parameters
+func (p *Provider) checkAuthentication(w http.ResponseWriter, vals url.Values) {
+	response := map[string]string{
+		"ns":       nsOpenID2,
+		"is_valid": "false",
+	}
+	keys := []string{"ns", "is_valid"}
+
+	// The OP MUST NOT verify signatures for associations that have
+	// shared MAC keys.
+	if assoc := p.Associations.Get(vals.Get("openid.assoc_handle")); assoc != nil && assoc.Private {
+		// The signature covers the fields of the positive assertion,
+		// in which openid.mode was "id_res".
+		signedVals := url.Values{}
+		for k, v := range vals {
+			signedVals[k] = v
+		}
+		signedVals.Set("openid.mode", "id_res")
+		signed := strings.Split(vals.Get("openid.signed"), ",")
+		if assoc.Verify(signedVals, signed, vals.Get("openid.sig")) &&
+			p.Nonces.Accept(p.Endpoint, vals.Get("openid.response_nonce")) == nil {
+			response["is_valid"] = "true"
+			// The association signed this assertion only.
+			p.Associations.Delete(assoc.Handle)
+		}
+	}
+
+	// If present in a verification request, the OP MUST verify
+	// invalidate_handle, and include it in the response if the
+	// association is not valid anymore.
+	if h := vals.Get("openid.invalidate_handle"); len(h) > 0 && p.Associations.Get(h) == nil {
+		response["invalidate_handle"] = h
+		keys = append(keys, "invalidate_handle")
+	}
+	writeDirectResponse(w, http.StatusOK, keys, response)
+}
+
+// Adds vals to the query of returnTo, and redirects the end user
+// there, with a form POST if the URL is too long.
+func redirect(w http.ResponseWriter, r *http.Request, returnTo string, vals url.Values) {
+	sep := "?"
+	if strings.Contains(returnTo, "?") {
+		sep = "&"
+	}
+	openid.Redirect(w, r, returnTo+sep+vals.Encode())
+}
+
+// 5.1.2.  Direct Response
+func writeDirectResponse(w http.ResponseWriter, status int, keys []string, vals map[string]string) {
+	body, err := openid.EncodeKeyValueForm(keys, vals)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// 5.1.2.2.  Error Responses
+func writeDirectError(w http.ResponseWriter, msg, errorCode string) {
+	vals := map[string]string{
+		"ns":    nsOpenID2,
+		"error": strings.Replace(msg, "\n", " ", -1),
+	}
+	keys := []string{"ns", "error"}
+	if len(errorCode) > 0 {
+		vals["error_code"] = errorCode
+		keys = append(keys, "error_code")
+	}
+	writeDirectResponse(w, http.StatusBadRequest, keys, vals)
+}
+
+// 5.2.3.  Indirect Error Responses
+// If the request is malformed, the OP sends the end user back to the
+// return_to URL, if it is valid. Otherwise the OP SHOULD present an
+// error message.
+func writeIndirectError(w http.ResponseWriter, r *http.Request, returnTo, msg string) {
+	if u, err := url.Parse(returnTo); err == nil && u.IsAbs() &&
+		(u.Scheme == "http" || u.Scheme == "https") {
+		redirect(w, r, returnTo, url.Values{
+			"openid.ns":    {nsOpenID2},
+			"openid.mode":  {"error"},
+			"openid.error": {msg},
+		})
+		return
+	}
+	http.Error(w, msg, http.StatusBadRequest)
+}
@@ -0,0 +1,357 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yohcop/openid-go"
+	"golang.org/x/net/html"
+)
+
+const testReturnTo = "http://rp.example.com/openid/callback"
+
+// Starts an OP at /op, with identity pages at /id/<name>.
+func newTestServer(decide DecisionFunc) (*httptest.Server, *Provider) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	p := NewProvider(server.URL+"/op", decide)
+	mux.Handle("/op", p)
+	mux.Handle("/id/", &openid.IdentityPage{OpEndpoint: p.Endpoint})
+	return server, p
+}
+
+func allow(w http.ResponseWriter, r *http.Request, req *AuthRequest) Decision {
+	return Decision{Outcome: Allow}
+}
+
+func deny(w http.ResponseWriter, r *http.Request, req *AuthRequest) Decision {
+	return Decision{Outcome: Deny}
+}
+
+// Follows the redirect URL to the OP, and returns the URL the OP
+// redirects the end user back to.
+func authenticate(t *testing.T, client *http.Client, redirectURL string) string {
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Get(redirectURL)
+	if err != nil {
+		t.Fatalf("Could not send the authentication request: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect, got %s", resp.Status)
+	}
+	return resp.Header.Get("Location")
+}
+
+func TestPositiveAssertionVerifies(t *testing.T) {
+	server, p := newTestServer(allow)
+	defer server.Close()
+	oid := openid.NewOpenID(server.Client())
+
+	redirectURL, err := oid.RedirectURL(server.URL+"/id/alice", testReturnTo, "http://rp.example.com/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assertion := authenticate(t, server.Client(), redirectURL)
+	if !strings.HasPrefix(assertion, testReturnTo+"?") {
+		t.Fatalf("Unexpected redirect: %s", assertion)
+	}
+
+	// Signed with a short-lived private association.
+	u, _ := url.Parse(assertion)
+	handle := u.Query().Get("openid.assoc_handle")
+	if assoc := p.Associations.Get(handle); assoc == nil || !assoc.Private ||
+		assoc.Expires.After(time.Now().Add(privateAssociationLifetime)) {
+		t.Fatalf("Unexpected association: %v", assoc)
+	}
+
+	nonceStore := openid.NewSimpleNonceStore()
+	id, err := oid.Verify(assertion, openid.NewSimpleDiscoveryCache(), nonceStore)
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if id != server.URL+"/id/alice" {
+		t.Errorf("Unexpected identity: %s", id)
+	}
+
+	if p.Associations.Get(handle) != nil {
+		t.Errorf("Private association kept after check_authentication")
+	}
+
+	// The signature can't be verified twice.
+	if _, err := oid.Verify(assertion, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore()); err == nil {
+		t.Errorf("Verify succeeded twice")
+	}
+}
+
+func TestTamperedAssertion(t *testing.T) {
+	server, _ := newTestServer(allow)
+	defer server.Close()
+	oid := openid.NewOpenID(server.Client())
+
+	redirectURL, _ := oid.RedirectURL(server.URL+"/id/alice", testReturnTo, "")
+	assertion := authenticate(t, server.Client(), redirectURL)
+	tampered := strings.Replace(assertion,
+		url.QueryEscape(server.URL+"/id/alice"),
+		url.QueryEscape(server.URL+"/id/mallory"), -1)
+	if tampered == assertion {
+		t.Fatalf("Could not tamper with the assertion: %s", assertion)
+	}
+	if _, err := oid.Verify(tampered, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore()); err == nil {
+		t.Errorf("Verify succeeded with a tampered assertion")
+	}
+}
+
+func TestIdentifierSelect(t *testing.T) {
+	var server *httptest.Server
+	server, _ = newTestServer(func(w http.ResponseWriter, r *http.Request, req *AuthRequest) Decision {
+		if !req.IdentifierSelect() {
+			t.Errorf("Expected an identifier_select request")
+		}
+		return Decision{
+			Outcome:    Allow,
+			ClaimedID:  server.URL + "/id/bob",
+			Extensions: map[string]string{"ns.sreg": "http://openid.net/extensions/sreg/1.1", "sreg.nickname": "bob"},
+		}
+	})
+	defer server.Close()
+	oid := openid.NewOpenID(server.Client())
+
+	// The OP Endpoint URL is also an OP Identifier.
+	redirectURL, err := oid.RedirectURL(server.URL+"/op", testReturnTo, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assertion := authenticate(t, server.Client(), redirectURL)
+	u, _ := url.Parse(assertion)
+	if signed := u.Query().Get("openid.signed"); !strings.HasSuffix(signed, ",ns.sreg,sreg.nickname") {
+		t.Errorf("Extensions not signed: %s", signed)
+	}
+	id, err := oid.Verify(assertion, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore())
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if id != server.URL+"/id/bob" {
+		t.Errorf("Unexpected identity: %s", id)
+	}
+}
+
+func TestExtensionsCannotOverrideCoreFields(t *testing.T) {
+	for _, extensions := range []map[string]string{
+		{"return_to": "http://evil.example.com/"},
+		{"claimed_id": "http://evil.example.com/id"},
+		{"ns.sreg": "http://openid.net/extensions/sreg/1.1", "sreg.nickname": "bob", "op_endpoint": "x"},
+		{"ns.sig": "http://example.com/ext"},
+		{"pape.policies": "none"},
+	} {
+		extensions := extensions
+		server, _ := newTestServer(func(w http.ResponseWriter, r *http.Request, req *AuthRequest) Decision {
+			return Decision{Outcome: Allow, Extensions: extensions}
+		})
+		redirectURL, _ := openid.BuildRedirectURL(server.URL+"/op", "", server.URL+"/id/alice", testReturnTo, "")
+		expectMode(t, authenticate(t, server.Client(), redirectURL), "error")
+		server.Close()
+	}
+}
+
+func TestNegativeAssertions(t *testing.T) {
+	server, _ := newTestServer(deny)
+	defer server.Close()
+
+	redirectURL, _ := openid.BuildRedirectURL(server.URL+"/op", "", server.URL+"/id/alice", testReturnTo, "")
+	expectMode(t, authenticate(t, server.Client(), redirectURL), "cancel")
+
+	immediate := strings.Replace(redirectURL, "checkid_setup", "checkid_immediate", 1)
+	expectMode(t, authenticate(t, server.Client(), immediate), "setup_needed")
+
+	// return_to not within the realm.
+	bad := redirectURL + "&openid.realm=" + url.QueryEscape("http://other.example.com/")
+	expectMode(t, authenticate(t, server.Client(), bad), "error")
+}
+
+func expectMode(t *testing.T, assertion, mode string) {
+	u, err := url.Parse(assertion)
+	if err != nil {
+		t.Fatalf("Bad assertion URL: %s", err)
+	}
+	if m := u.Query().Get("openid.mode"); m != mode {
+		t.Errorf("Expected mode %s, got %s (%s)", mode, m, assertion)
+	}
+}
+
+func TestAssociateDiffieHellman(t *testing.T) {
+	server, p := newTestServer(allow)
+	defer server.Close()
+
+	// The Relying Party side of the key exchange.
+	private := big.NewInt(123456789)
+	public := new(big.Int).Exp(defaultGenerator, private, defaultModulus)
+	resp, err := server.Client().PostForm(server.URL+"/op", url.Values{
+		"openid.ns":                 {nsOpenID2},
+		"openid.mode":               {"associate"},
+		"openid.assoc_type":         {"HMAC-SHA256"},
+		"openid.session_type":       {"DH-SHA256"},
+		"openid.dh_consumer_public": {base64.StdEncoding.EncodeToString(btwoc(public))},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	kv := readKeyValueForm(t, resp)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Association failed: %v", kv)
+	}
+
+	serverPublic, err := decodeBtwoc(kv["dh_server_public"])
+	if err != nil {
+		t.Fatalf("Bad dh_server_public: %s", err)
+	}
+	encMacKey, _ := base64.StdEncoding.DecodeString(kv["enc_mac_key"])
+	shared := sha256.Sum256(btwoc(new(big.Int).Exp(serverPublic, private, defaultModulus)))
+	macKey := make([]byte, len(encMacKey))
+	for i := range macKey {
+		macKey[i] = encMacKey[i] ^ shared[i]
+	}
+
+	assoc := p.Associations.Get(kv["assoc_handle"])
+	if assoc == nil || assoc.Private {
+		t.Fatalf("Shared association not stored: %v", assoc)
+	}
+	if string(assoc.Secret) != string(macKey) {
+		t.Errorf("Decrypted MAC key does not match")
+	}
+
+	// Assertions requested with this handle are signed with it.
+	redirectURL, _ := openid.BuildRedirectURL(server.URL+"/op", "", server.URL+"/id/alice", testReturnTo, "")
+	assertion, _ := url.Parse(authenticate(t, server.Client(), redirectURL+"&openid.assoc_handle="+url.QueryEscape(assoc.Handle)))
+	vals := assertion.Query()
+	if vals.Get("openid.assoc_handle") != assoc.Handle {
+		t.Errorf("Assertion not signed with the shared association")
+	}
+	shareAssoc := &Association{Type: "HMAC-SHA256", Secret: macKey}
+	if !shareAssoc.Verify(vals, strings.Split(vals.Get("openid.signed"), ","), vals.Get("openid.sig")) {
+		t.Errorf("Bad signature")
+	}
+}
+
+func TestAssociateUnsupported(t *testing.T) {
+	server, _ := newTestServer(allow)
+	defer server.Close()
+
+	for _, sessionType := range []string{"no-encryption", "DH-SHA1", "DH-FOO"} {
+		resp, err := server.Client().PostForm(server.URL+"/op", url.Values{
+			"openid.ns":                 {nsOpenID2},
+			"openid.mode":               {"associate"},
+			"openid.assoc_type":         {"HMAC-SHA256"},
+			"openid.session_type":       {sessionType},
+			"openid.dh_consumer_public": {"Ag=="},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		kv := readKeyValueForm(t, resp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || kv["error_code"] != "unsupported-type" {
+			t.Errorf("Expected unsupported-type for %s, got %s %v", sessionType, resp.Status, kv)
+		}
+	}
+}
+
+func TestAssociateLargeModulus(t *testing.T) {
+	server, _ := newTestServer(allow)
+	defer server.Close()
+
+	modulus := new(big.Int).Lsh(big.NewInt(1), 16384)
+	modulus.Add(modulus, big.NewInt(1))
+	resp, err := server.Client().PostForm(server.URL+"/op", url.Values{
+		"openid.ns":                 {nsOpenID2},
+		"openid.mode":               {"associate"},
+		"openid.assoc_type":         {"HMAC-SHA256"},
+		"openid.session_type":       {"DH-SHA256"},
+		"openid.dh_modulus":         {base64.StdEncoding.EncodeToString(btwoc(modulus))},
+		"openid.dh_consumer_public": {"Ag=="},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	kv := readKeyValueForm(t, resp)
+	if resp.StatusCode != http.StatusBadRequest || len(kv["assoc_handle"]) > 0 {
+		t.Errorf("Expected an error, got %s %v", resp.Status, kv)
+	}
+}
+
+func readKeyValueForm(t *testing.T, resp *http.Response) map[string]string {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Could not read response: %s", err)
+	}
+	kv, err := openid.ParseKeyValueForm(body)
+	if err != nil {
+		t.Fatalf("Bad Key-Value form response: %s", err)
+	}
+	return kv
+}
+
+func TestLongAssertionFormPost(t *testing.T) {
+	server, _ := newTestServer(allow)
+	defer server.Close()
+	oid := openid.NewOpenID(server.Client())
+
+	returnTo := testReturnTo + "?state=" + strings.Repeat("x", openid.MaxRedirectURLLength)
+	redirectURL, err := oid.RedirectURL(server.URL+"/id/alice", returnTo, "http://rp.example.com/")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp, err := server.Client().Get(redirectURL)
+	if err != nil {
+		t.Fatalf("Could not send the authentication request: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a form, got %s", resp.Status)
+	}
+
+	// Submit the form to the RP.
+	action := ""
+	form := make(url.Values)
+	tokenizer := html.NewTokenizer(resp.Body)
+	for tt := tokenizer.Next(); tt != html.ErrorToken; tt = tokenizer.Next() {
+		tk := tokenizer.Token()
+		attrs := map[string]string{}
+		for _, attr := range tk.Attr {
+			attrs[attr.Key] = attr.Val
+		}
+		if tt == html.EndTagToken {
+			continue
+		}
+		if tk.Data == "form" {
+			action = attrs["action"]
+		} else if tk.Data == "input" && attrs["type"] == "hidden" {
+			form.Add(attrs["name"], attrs["value"])
+		}
+	}
+	if action != returnTo {
+		t.Fatalf("Unexpected form action: %s", action)
+	}
+	r := httptest.NewRequest("POST", action, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	id, err := oid.VerifyRequest(r, openid.NewSimpleDiscoveryCache(), openid.NewSimpleNonceStore())
+	if err != nil {
+		t.Fatalf("Verify failed: %s", err)
+	}
+	if id != server.URL+"/id/alice" {
+		t.Errorf("Unexpected identity: %s", id)
+	}
+}
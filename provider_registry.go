@@ -0,0 +1,139 @@
+package openid
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// ProviderInfo describes a well-known OP, to be offered to the end user
+// as a "Sign in with" button for example. The end user then chooses
+// their identifier at the OP (identifier select, 7.3.1).
+type ProviderInfo struct {
+	// Name identifies the OP in a ProviderRegistry, e.g. "steam".
+	Name        string
+	DisplayName string
+	// OPIdentifier is the OP Identifier URL, discovered to find the OP
+	// Endpoint URL.
+	OPIdentifier string
+	// Optional.
+	IconURL string
+	// Extension parameters the OP requires in authentication
+	// requests, such as "openid.ns.sreg" and "openid.sreg.required".
+	Extensions url.Values
+}
+
+// ProviderRegistry is a set of ProviderInfo, by name. It is safe for
+// concurrent use.
+type ProviderRegistry struct {
+	mutex     sync.RWMutex
+	providers map[string]*ProviderInfo
+}
+
+// NewProviderRegistry returns a registry of providers.
+func NewProviderRegistry(providers ...*ProviderInfo) *ProviderRegistry {
+	r := &ProviderRegistry{providers: map[string]*ProviderInfo{}}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// Register adds p to the registry, replacing the provider with the
+// same name if any.
+func (r *ProviderRegistry) Register(p *ProviderInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.providers[p.Name] = p
+}
+
+// Lookup returns the provider with this name, or nil.
+func (r *ProviderRegistry) Lookup(name string) *ProviderInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.providers[name]
+}
+
+// Providers returns all the providers, sorted by name.
+func (r *ProviderRegistry) Providers() []*ProviderInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	providers := make([]*ProviderInfo, 0, len(r.providers))
+	for _, p := range r.providers {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name < providers[j].Name
+	})
+	return providers
+}
+
+// DefaultProviders is the registry used by OpenID instances without
+// their own Providers. Applications can register more providers.
+var DefaultProviders = NewProviderRegistry(
+	&ProviderInfo{
+		Name:         "steam",
+		DisplayName:  "Steam",
+		OPIdentifier: "https://steamcommunity.com/openid",
+		IconURL:      "https://steamcommunity.com/favicon.ico",
+	},
+)
+
+func (oid *OpenID) providers() *ProviderRegistry {
+	if oid.Providers != nil {
+		return oid.Providers
+	}
+	return DefaultProviders
+}
+
+// RedirectURLForProvider is like RedirectURL, for the OP Identifier of
+// the provider with this name. The extension parameters of the
+// provider are added to the request.
+func RedirectURLForProvider(name, callbackURL, realm string) (string, error) {
+	return defaultInstance.RedirectURLForProvider(name, callbackURL, realm)
+}
+
+func (oid *OpenID) RedirectURLForProvider(name, callbackURL, realm string) (string, error) {
+	return oid.RedirectURLForProviderContext(context.Background(), name, callbackURL, realm)
+}
+
+// RedirectURLForProviderContext is like RedirectURLForProvider, with a
+// context for the discovery HTTP requests.
+func (oid *OpenID) RedirectURLForProviderContext(ctx context.Context, name, callbackURL, realm string) (string, error) {
+	p, err := oid.lookupProvider(name)
+	if err != nil {
+		return "", err
+	}
+	info, err := oid.discover(ctx, p.OPIdentifier)
+	if err != nil {
+		return "", err
+	}
+	return BuildRedirectURL(info.opEndpoint, info.opLocalID, info.claimedID, callbackURL, realm, p.Extensions)
+}
+
+// StartTransactionForProvider is like StartTransaction, for the OP
+// Identifier of the provider with this name. The extension parameters
+// of the provider are added to the request. Since the assertion is
+// verified with the transaction, it is accepted whatever the
+// UnsolicitedPolicy.
+func StartTransactionForProvider(ctx context.Context, name, callbackURL, realm string) (tx *Transaction, redirectURL string, err error) {
+	return defaultInstance.StartTransactionForProvider(ctx, name, callbackURL, realm)
+}
+
+func (oid *OpenID) StartTransactionForProvider(ctx context.Context, name, callbackURL, realm string) (tx *Transaction, redirectURL string, err error) {
+	p, err := oid.lookupProvider(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return oid.startTransaction(ctx, p.OPIdentifier, callbackURL, realm, p.Extensions)
+}
+
+func (oid *OpenID) lookupProvider(name string) (*ProviderInfo, error) {
+	p := oid.providers().Lookup(name)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
@@ -0,0 +1,109 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	r := NewProviderRegistry(&ProviderInfo{Name: "b"}, &ProviderInfo{Name: "a"})
+	r.Register(&ProviderInfo{Name: "c"})
+	r.Register(&ProviderInfo{Name: "a", DisplayName: "A"})
+	if p := r.Lookup("a"); p == nil || p.DisplayName != "A" {
+		t.Errorf("Unexpected provider: %v", p)
+	}
+	if p := r.Lookup("d"); p != nil {
+		t.Errorf("Unexpected provider: %v", p)
+	}
+	providers := r.Providers()
+	if len(providers) != 3 || providers[0].Name != "a" || providers[1].Name != "b" || providers[2].Name != "c" {
+		t.Errorf("Unexpected providers: %v", providers)
+	}
+
+	if p := DefaultProviders.Lookup("steam"); p == nil || p.OPIdentifier != "https://steamcommunity.com/openid" {
+		t.Errorf("Unexpected Steam provider: %v", p)
+	}
+}
+
+func TestRedirectURLForProvider(t *testing.T) {
+	server := httptest.NewServer(NewOPIdentifierXrds("https://op.example.com/server"))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Providers = NewProviderRegistry(&ProviderInfo{
+		Name:         "example",
+		OPIdentifier: server.URL,
+		Extensions: url.Values{
+			"openid.ns.sreg":       {"http://openid.net/extensions/sreg/1.1"},
+			"openid.sreg.required": {"nickname"},
+		},
+	})
+
+	redirectURL, err := oid.RedirectURLForProvider("example", "http://rp.example.com/return", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	u, _ := url.Parse(redirectURL)
+	q := u.Query()
+	if u.Host != "op.example.com" ||
+		q.Get("openid.claimed_id") != "http://specs.openid.net/auth/2.0/identifier_select" ||
+		q.Get("openid.sreg.required") != "nickname" ||
+		q.Get("openid.ns.sreg") != "http://openid.net/extensions/sreg/1.1" {
+		t.Errorf("Unexpected redirect: %s", redirectURL)
+	}
+
+	if _, err = oid.RedirectURLForProvider("steam", "http://rp.example.com/return", ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected an unknown provider, got %v", err)
+	}
+
+	// Extensions cannot override the core protocol fields.
+	for _, ext := range []url.Values{
+		{"openid.return_to": {"https://attacker.example.com/"}},
+		{"openid.ns.sreg": {"http://openid.net/extensions/sreg/1.1"}, "openid.mode": {"checkid_immediate"}},
+		{"openid.ns.mode": {"http://openid.net/extensions/sreg/1.1"}},
+		{"return_to": {"https://attacker.example.com/"}},
+	} {
+		oid.Providers.Register(&ProviderInfo{Name: "invalid", OPIdentifier: server.URL, Extensions: ext})
+		if _, err = oid.RedirectURLForProvider("invalid", "http://rp.example.com/return", ""); !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("%v: expected an invalid extension, got %v", ext, err)
+		}
+	}
+}
+
+func TestStartTransactionForProvider(t *testing.T) {
+	server := httptest.NewServer(NewOPIdentifierXrds("https://op.example.com/server"))
+	defer server.Close()
+
+	oid := NewOpenID(server.Client())
+	oid.Providers = NewProviderRegistry(&ProviderInfo{
+		Name:         "example",
+		OPIdentifier: server.URL,
+		Extensions: url.Values{
+			"openid.ns.sreg":       {"http://openid.net/extensions/sreg/1.1"},
+			"openid.sreg.required": {"nickname"},
+		},
+	})
+
+	tx, redirectURL, err := oid.StartTransactionForProvider(context.Background(), "example", "http://rp.example.com/return", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if tx.UserSuppliedID != server.URL || len(tx.ClaimedID) != 0 ||
+		tx.OpEndpoint != "https://op.example.com/server" || len(tx.State) == 0 {
+		t.Errorf("Unexpected transaction: %+v", tx)
+	}
+	u, _ := url.Parse(redirectURL)
+	q := u.Query()
+	if q.Get("openid.return_to") != "http://rp.example.com/return?rp_state="+tx.State ||
+		q.Get("openid.claimed_id") != "http://specs.openid.net/auth/2.0/identifier_select" ||
+		q.Get("openid.sreg.required") != "nickname" {
+		t.Errorf("Unexpected redirect: %s", redirectURL)
+	}
+
+	if _, _, err = oid.StartTransactionForProvider(context.Background(), "steam", "http://rp.example.com/return", ""); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected an unknown provider, got %v", err)
+	}
+}
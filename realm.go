@@ -0,0 +1,122 @@
+package openid
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 9.2.  Realms
+// A "realm" is a pattern that represents the part of URL-space for
+// which an OpenID Authentication request is valid. [...] The realm
+// MUST NOT contain a URI fragment. A realm MAY contain a wildcard
+// at the beginning of the URL authority section. A wildcard consists
+// of the characters "*." prepended to the DNS name in the authority
+// section of the URL.
+type Realm struct {
+	Scheme string
+	// Domain is the host name, without the wildcard if any.
+	Domain   string
+	Wildcard bool
+	// Port is the explicit port of the realm, or the default port
+	// for its scheme.
+	Port string
+	Path string
+}
+
+// ParseRealm parses and validates an openid.realm value. Realms
+// with a wildcard covering a whole public suffix (e.g.
+// "http://*.com/" or "http://*.co.uk/") are rejected as overly broad.
+func ParseRealm(realm string) (*Realm, error) {
+	u, err := url.Parse(realm)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Realm must be an http(s) URL: %s", realm)
+	}
+	if len(u.Fragment) > 0 || strings.Contains(realm, "#") {
+		return nil, fmt.Errorf("Realm must not contain a fragment: %s", realm)
+	}
+	r := &Realm{
+		Scheme: u.Scheme,
+		Domain: strings.ToLower(u.Hostname()),
+		Port:   effectivePort(u),
+		Path:   u.Path,
+	}
+	if strings.HasPrefix(r.Domain, "*.") {
+		r.Wildcard = true
+		r.Domain = r.Domain[2:]
+	}
+	if len(r.Domain) == 0 || strings.Contains(r.Domain, "*") {
+		return nil, fmt.Errorf("Invalid realm domain: %s", realm)
+	}
+	if r.Wildcard {
+		// 9.2.1 (Using the Realm for Return URL Verification): OPs
+		// SHOULD NOT allow wildcards that are too wide.
+		if suffix, _ := publicsuffix.PublicSuffix(r.Domain); suffix == r.Domain {
+			return nil, fmt.Errorf("Realm is overly broad: %s", realm)
+		}
+	}
+	if len(r.Path) == 0 {
+		r.Path = "/"
+	}
+	return r, nil
+}
+
+// Matches returns true if the return_to URL is within the realm:
+//   - The return_to URL scheme and port are the same as the realm's.
+//   - The domain names are equal, or the realm has a wildcard and the
+//     return_to domain name is a sub-domain of the realm's.
+//   - The path of the return_to URL is equal to, or is a
+//     sub-directory of, the realm's path.
+func (r *Realm) Matches(returnTo string) bool {
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != r.Scheme || effectivePort(u) != r.Port {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != r.Domain &&
+		!(r.Wildcard && strings.HasSuffix(host, "."+r.Domain)) {
+		return false
+	}
+	path := u.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, r.Path) {
+		return false
+	}
+	// "/foo" matches "/foo" and "/foo/bar", but not "/foobar".
+	return len(path) == len(r.Path) ||
+		strings.HasSuffix(r.Path, "/") ||
+		path[len(r.Path)] == '/'
+}
+
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); len(port) > 0 {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// Validates the realm, and makes sure returnTo is within it.
+func checkRealm(realm, returnTo string) error {
+	r, err := ParseRealm(realm)
+	if err != nil {
+		return err
+	}
+	if !r.Matches(returnTo) {
+		return errors.New("return_to URL is not within the realm")
+	}
+	return nil
+}
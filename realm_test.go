@@ -0,0 +1,71 @@
+package openid
+
+import (
+	"testing"
+)
+
+func TestParseRealm(t *testing.T) {
+	for _, realm := range []string{
+		"http://example.com/",
+		"https://example.com",
+		"http://example.com:8080/path/",
+		"http://*.example.com/",
+		"https://*.example.co.uk/",
+	} {
+		if _, err := ParseRealm(realm); err != nil {
+			t.Errorf("Unexpected error parsing realm %s: %s", realm, err)
+		}
+	}
+	for _, realm := range []string{
+		"",
+		"example.com",
+		"ftp://example.com/",
+		"http://example.com/#frag",
+		"http://*/",
+		"http://*.com/",
+		"http://*.co.uk/",
+		"http://foo.*.example.com/",
+		"http://www.*.com/",
+	} {
+		if _, err := ParseRealm(realm); err == nil {
+			t.Errorf("Expected an error parsing realm %s", realm)
+		}
+	}
+}
+
+func TestRealmMatches(t *testing.T) {
+	// Examples from section 9.2 of the specs, and more.
+	for _, c := range []struct {
+		realm, returnTo string
+		match           bool
+	}{
+		{"http://example.com/", "http://example.com/", true},
+		{"http://example.com/", "http://example.com/path?q=1", true},
+		{"http://example.com", "http://example.com/path", true},
+		{"http://example.com/", "http://EXAMPLE.com/path", true},
+		{"http://example.com/", "http://www.example.com/", false},
+		{"http://*.example.com/", "http://www.example.com/", true},
+		{"http://*.example.com/", "http://a.b.example.com/", true},
+		{"http://*.example.com/", "http://example.com/", true},
+		{"http://*.example.com/", "http://badexample.com/", false},
+		{"http://example.com/", "https://example.com/", false},
+		{"http://example.com/", "http://example.com:80/", true},
+		{"http://example.com/", "http://example.com:8080/", false},
+		{"http://example.com:8080/", "http://example.com:8080/a", true},
+		{"http://example.com/foo", "http://example.com/foo", true},
+		{"http://example.com/foo", "http://example.com/foo/bar", true},
+		{"http://example.com/foo", "http://example.com/foobar", false},
+		{"http://example.com/foo/", "http://example.com/foo", false},
+		{"http://example.com/foo/", "http://example.com/foo/bar", true},
+		{"http://example.com/foo/", "http://example.com/bar", false},
+	} {
+		r, err := ParseRealm(c.realm)
+		if err != nil {
+			t.Errorf("Unexpected error parsing realm %s: %s", c.realm, err)
+			continue
+		}
+		if m := r.Matches(c.returnTo); m != c.match {
+			t.Errorf("Realm %s, return_to %s: Expected %v, Got %v", c.realm, c.returnTo, c.match, m)
+		}
+	}
+}
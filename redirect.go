@@ -1,6 +1,8 @@
 package openid
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"strings"
 )
@@ -10,14 +12,88 @@ func RedirectURL(id, callbackURL, realm string) (string, error) {
 }
 
 func (oid *OpenID) RedirectURL(id, callbackURL, realm string) (string, error) {
-	opEndpoint, opLocalID, claimedID, err := oid.Discover(id)
+	return oid.RedirectURLContext(context.Background(), id, callbackURL, realm)
+}
+
+// RedirectURLContext is like RedirectURL, with a context for the
+// discovery HTTP requests.
+func (oid *OpenID) RedirectURLContext(ctx context.Context, id, callbackURL, realm string) (string, error) {
+	info, err := oid.discover(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return BuildRedirectURL(info.opEndpoint, info.opLocalID, info.claimedID, callbackURL, realm)
+}
+
+// RedirectURLWithCache is like RedirectURLContext, and also puts the
+// discovered information in cache, if not nil, so that Verify does not
+// discover the claimed identifier again. The request is recorded in
+// OpenID.Solicitations: with an UnsolicitedPolicy other than
+// AcceptUnsolicited, it is how an assertion verified without a
+// transaction is known to be solicited.
+func RedirectURLWithCache(ctx context.Context, id, callbackURL, realm string, cache DiscoveryCache) (string, error) {
+	return defaultInstance.RedirectURLWithCache(ctx, id, callbackURL, realm, cache)
+}
+
+func (oid *OpenID) RedirectURLWithCache(ctx context.Context, id, callbackURL, realm string, cache DiscoveryCache) (string, error) {
+	info, err := oid.discover(ctx, id)
 	if err != nil {
 		return "", err
 	}
-	return BuildRedirectURL(opEndpoint, opLocalID, claimedID, callbackURL, realm)
+	// OP Identifiers have no claimed identifier to remember.
+	if len(info.claimedID) > 0 {
+		if cache != nil {
+			cache.Put(info.claimedID, info)
+		}
+		if oid.Solicitations != nil {
+			oid.Solicitations.Add(info.claimedID, info.opEndpoint)
+		}
+	}
+	return BuildRedirectURL(info.opEndpoint, info.opLocalID, info.claimedID, callbackURL, realm)
+}
+
+// StartTransaction is like RedirectURLContext, but also returns the
+// started transaction. The state of the transaction is added to
+// callbackURL. The transaction must be saved in a TransactionStore,
+// and passed to VerifyTransaction with the callback request.
+func StartTransaction(ctx context.Context, id, callbackURL, realm string) (tx *Transaction, redirectURL string, err error) {
+	return defaultInstance.StartTransaction(ctx, id, callbackURL, realm)
+}
+
+func (oid *OpenID) StartTransaction(ctx context.Context, id, callbackURL, realm string) (tx *Transaction, redirectURL string, err error) {
+	return oid.startTransaction(ctx, id, callbackURL, realm, nil)
+}
+
+func (oid *OpenID) startTransaction(ctx context.Context, id, callbackURL, realm string, extensions url.Values) (tx *Transaction, redirectURL string, err error) {
+	info, err := oid.discover(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if tx, err = NewTransaction(); err != nil {
+		return nil, "", err
+	}
+	tx.UserSuppliedID = id
+	tx.ClaimedID = info.claimedID
+	tx.OpEndpoint = info.opEndpoint
+	tx.OpLocalID = info.opLocalID
+	tx.Expires = info.expires
+	returnTo, err := tx.ReturnTo(callbackURL)
+	if err != nil {
+		return nil, "", err
+	}
+	redirectURL, err = BuildRedirectURL(tx.OpEndpoint, tx.OpLocalID, tx.ClaimedID, returnTo, realm, extensions)
+	if err != nil {
+		return nil, "", err
+	}
+	return tx, redirectURL, nil
 }
 
-func BuildRedirectURL(opEndpoint, opLocalID, claimedID, returnTo, realm string) (string, error) {
+// BuildRedirectURL returns the URL of an authentication request to
+// the OP. The parameters of extensions, such as "openid.ns.sreg" and
+// "openid.sreg.required", are added to the request. They must be in
+// declared extension namespaces (see CheckExtensionKeys), otherwise
+// the error wraps ErrInvalidExtension.
+func BuildRedirectURL(opEndpoint, opLocalID, claimedID, returnTo, realm string, extensions ...url.Values) (string, error) {
 	values := make(url.Values)
 	values.Add("openid.ns", "http://specs.openid.net/auth/2.0")
 	values.Add("openid.mode", "checkid_setup")
@@ -45,11 +121,44 @@ func BuildRedirectURL(opEndpoint, opLocalID, claimedID, returnTo, realm string)
 	}
 
 	if len(realm) > 0 {
+		// 9.2: The "openid.return_to" URL MUST descend from the
+		// "openid.realm".
+		if err := checkRealm(realm, returnTo); err != nil {
+			return "", err
+		}
 		values.Add("openid.realm", realm)
 	}
 
+	for _, ext := range extensions {
+		if err := addExtensions(values, ext); err != nil {
+			return "", err
+		}
+	}
+
 	if strings.Contains(opEndpoint, "?") {
 		return opEndpoint + "&" + values.Encode(), nil
 	}
 	return opEndpoint + "?" + values.Encode(), nil
 }
+
+// Adds the extension parameters ext to the request values, refusing
+// those that are not in a declared extension namespace, and so could
+// override the core protocol fields.
+func addExtensions(values, ext url.Values) error {
+	keys := make([]string, 0, len(ext))
+	for k := range ext {
+		if !strings.HasPrefix(k, "openid.") {
+			return fmt.Errorf("%w: %q is not an OpenID field", ErrInvalidExtension, k)
+		}
+		keys = append(keys, strings.TrimPrefix(k, "openid."))
+	}
+	if err := CheckExtensionKeys(keys); err != nil {
+		return err
+	}
+	for k, vs := range ext {
+		for _, v := range vs {
+			values.Add(k, v)
+		}
+	}
+	return nil
+}
@@ -1,19 +1,22 @@
 package openid
 
 import (
+	"context"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 )
 
 func TestBuildRedirectUrl(t *testing.T) {
-	expectURL(t, "https://endpoint/a", "opLocalId", "claimedId", "returnTo", "realm",
+	expectURL(t, "https://endpoint/a", "opLocalId", "claimedId",
+		"https://rp.example.com/returnTo", "https://*.example.com/",
 		"https://endpoint/a?"+
 			"openid.ns=http://specs.openid.net/auth/2.0"+
 			"&openid.mode=checkid_setup"+
-			"&openid.return_to=returnTo"+
+			"&openid.return_to=https://rp.example.com/returnTo"+
 			"&openid.claimed_id=claimedId"+
 			"&openid.identity=opLocalId"+
-			"&openid.realm=realm")
+			"&openid.realm=https://*.example.com/")
 	// No realm.
 	expectURL(t, "https://endpoint/a", "opLocalId", "claimedId", "returnTo", "",
 		"https://endpoint/a?"+
@@ -42,6 +45,22 @@ func TestBuildRedirectUrl(t *testing.T) {
 			"http://specs.openid.net/auth/2.0/identifier_select")
 }
 
+func TestBuildRedirectUrlRealmMismatch(t *testing.T) {
+	for _, c := range []struct{ returnTo, realm string }{
+		// Outside of the realm.
+		{"https://rp.example.com/cb", "https://other.example.com/"},
+		{"http://rp.example.com/cb", "https://rp.example.com/"},
+		{"https://rp.example.com/cb", "https://rp.example.com/openid/"},
+		// Invalid or overly broad realm.
+		{"https://rp.example.com/cb", "https://*.com/"},
+		{"https://rp.example.com/cb", "https://rp.example.com/#frag"},
+	} {
+		if _, err := BuildRedirectURL("https://endpoint/a", "", "claimedId", c.returnTo, c.realm); err == nil {
+			t.Errorf("Expected an error for return_to %s and realm %s", c.returnTo, c.realm)
+		}
+	}
+}
+
 func expectURL(t *testing.T, opEndpoint, opLocalID, claimedID, returnTo, realm, expected string) {
 	url, err := BuildRedirectURL(opEndpoint, opLocalID, claimedID, returnTo, realm)
 	if err != nil {
@@ -51,22 +70,56 @@ func expectURL(t *testing.T, opEndpoint, opLocalID, claimedID, returnTo, realm,
 }
 
 func TestRedirectWithDiscovery(t *testing.T) {
-	expected := "foo?" +
-		"openid.ns=http://specs.openid.net/auth/2.0" +
-		"&openid.mode=checkid_setup" +
-		"&openid.return_to=mysite/cb" +
-		"&openid.claimed_id=" +
-		"http://specs.openid.net/auth/2.0/identifier_select" +
-		"&openid.identity=" +
-		"http://specs.openid.net/auth/2.0/identifier_select"
+	// They all redirect to the same XRDS document, and the Yadis URL
+	// is the claimed ID.
+	for _, uri := range []string{
+		"http://example.com/xrds",
+		"http://example.com/xrds-loc",
+		"http://example.com/xrds-meta",
+	} {
+		expected := "http://example.com/foo?" +
+			"openid.ns=http://specs.openid.net/auth/2.0" +
+			"&openid.mode=checkid_setup" +
+			"&openid.return_to=mysite/cb" +
+			"&openid.claimed_id=" + url.QueryEscape(uri) +
+			"&openid.identity=http://example.com/bar"
+		expectRedirect(t, uri, "mysite/cb", "", expected, false)
+	}
 
-	// They all redirect to the same XRDS document
-	expectRedirect(t, "http://example.com/xrds",
-		"mysite/cb", "", expected, false)
-	expectRedirect(t, "http://example.com/xrds-loc",
-		"mysite/cb", "", expected, false)
-	expectRedirect(t, "http://example.com/xrds-meta",
-		"mysite/cb", "", expected, false)
+	// OP Identifier: identifier_select.
+	expectRedirect(t, "http://example.com/xrds-op", "mysite/cb", "",
+		"https://op.example.com/server?"+
+			"openid.ns=http://specs.openid.net/auth/2.0"+
+			"&openid.mode=checkid_setup"+
+			"&openid.return_to=mysite/cb"+
+			"&openid.claimed_id="+
+			"http://specs.openid.net/auth/2.0/identifier_select"+
+			"&openid.identity="+
+			"http://specs.openid.net/auth/2.0/identifier_select", false)
+}
+
+func TestRedirectURLWithCache(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	recorder := &recordingGetter{getter: NewHTTPGetter(server.Client())}
+	oid := NewOpenIDWithGetter(recorder)
+
+	cache := NewSimpleDiscoveryCache()
+	if _, err := oid.RedirectURLWithCache(context.Background(), server.URL+"/id", "http://rp.example.com/return", "", cache); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// The claimed identifier, without an OP-Local Identifier, is not
+	// discovered again.
+	recorder.requests = nil
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	r := httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil)
+	if _, err := oid.VerifyRequest(r, cache, NewSimpleNonceStore()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(recorder.requests) != 1 || recorder.requests[0] != "POST "+server.URL+"/op" {
+		t.Errorf("Unexpected requests: %v", recorder.requests)
+	}
 }
 
 func expectRedirect(t *testing.T, uri, callback, realm, exRedirect string, exErr bool) {
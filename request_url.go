@@ -0,0 +1,104 @@
+package openid
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestURL returns the URL r was sent to by the user agent, with its
+// scheme and host. By default, they are those of the connection to
+// this server: the scheme is https for TLS connections, and the host
+// is the Host header.
+//
+// If the request comes from one of the TrustedProxies, the scheme and
+// host are instead taken from the Forwarded header (RFC 7239), or from
+// the X-Forwarded-Proto and X-Forwarded-Host headers, as set by a load
+// balancer terminating TLS. Only the last entry of these headers, added
+// by the trusted proxy itself, is used.
+func (oid *OpenID) RequestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	u.Host = r.Host
+	u.User = nil
+	u.Fragment = ""
+
+	if oid.trustedProxy(r.RemoteAddr) {
+		proto, host := forwardedProtoHost(r.Header)
+		if proto == "http" || proto == "https" {
+			u.Scheme = proto
+		}
+		if validHost(host) {
+			u.Host = host
+		}
+	}
+	return &u
+}
+
+func (oid *OpenID) trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range oid.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the protocol and host forwarded by the proxy closest to this
+// server, that is the last one: proxies append to these headers, so
+// the previous entries come from the user agent or from untrusted hops
+// and may be spoofed. The Forwarded header takes precedence over the
+// X-Forwarded-* ones.
+func forwardedProtoHost(h http.Header) (proto, host string) {
+	if forwarded := lastValue(h["Forwarded"]); len(forwarded) > 0 {
+		// Forwarded: for=192.0.2.43;proto=https;host=example.com, for=...
+		for _, pair := range strings.Split(forwarded, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.Trim(kv[1], `"`)
+			switch strings.ToLower(kv[0]) {
+			case "proto":
+				proto = strings.ToLower(v)
+			case "host":
+				host = v
+			}
+		}
+		return
+	}
+	proto = strings.ToLower(lastValue(h["X-Forwarded-Proto"]))
+	host = lastValue(h["X-Forwarded-Host"])
+	return
+}
+
+// Returns the last entry of a comma-separated header, possibly sent in
+// several fields.
+func lastValue(fields []string) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	values := strings.Split(fields[len(fields)-1], ",")
+	return strings.TrimSpace(values[len(values)-1])
+}
+
+// Reports whether host is a valid host[:port] authority.
+func validHost(host string) bool {
+	if len(host) == 0 {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && len(u.Path) == 0 && u.User == nil
+}
@@ -0,0 +1,81 @@
+package openid
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestURL(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	oid := NewOpenID(nil)
+	oid.TrustedProxies = []*net.IPNet{proxies}
+
+	tests := []struct {
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		expected   string
+	}{
+		{"192.0.2.1:1234", false, nil, "http://rp.example.com/cb?a=b"},
+		{"192.0.2.1:1234", true, nil, "https://rp.example.com/cb?a=b"},
+		// Untrusted proxy.
+		{"192.0.2.1:1234", false, map[string]string{
+			"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com"},
+			"http://rp.example.com/cb?a=b"},
+		{"10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "https", "X-Forwarded-Host": "www.example.com:8443"},
+			"https://www.example.com:8443/cb?a=b"},
+		{"10.1.2.3:1234", false, map[string]string{
+			"Forwarded":         `for=192.0.2.43;proto=https;host="www.example.com"`,
+			"X-Forwarded-Proto": "http"},
+			"https://www.example.com/cb?a=b"},
+		// Values sent by the user agent, to which the trusted proxy
+		// appended its own, are ignored.
+		{"10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "https, HTTPS", "X-Forwarded-Host": "evil.example.com, www.example.com"},
+			"https://www.example.com/cb?a=b"},
+		{"10.1.2.3:1234", false, map[string]string{
+			"Forwarded": `host=evil.example.com;proto=https, for=192.0.2.43;host=www.example.com`},
+			"http://www.example.com/cb?a=b"},
+		{"10.1.2.3:1234", false, map[string]string{
+			"Forwarded": `host=evil.example.com;proto=https, for=192.0.2.43`},
+			"http://rp.example.com/cb?a=b"},
+		// Invalid values are ignored.
+		{"10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "ftp", "X-Forwarded-Host": "www.example.com/path"},
+			"http://rp.example.com/cb?a=b"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/cb?a=b", nil)
+		r.Host = "rp.example.com"
+		r.RemoteAddr = test.remoteAddr
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		if u := oid.RequestURL(r).String(); u != test.expected {
+			t.Errorf("Unexpected URL for %s %v: Expected %s, Got %s", test.remoteAddr, test.headers, test.expected, u)
+		}
+	}
+}
+
+func TestRequestURLSpoofedFields(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	oid := NewOpenID(nil)
+	oid.TrustedProxies = []*net.IPNet{proxies}
+
+	// The user agent sent its own header field, and the trusted proxy
+	// added another one.
+	r := httptest.NewRequest("GET", "/cb", nil)
+	r.Host = "rp.example.com"
+	r.RemoteAddr = "10.0.0.5:1234"
+	r.Header.Add("Forwarded", "host=evil.example.com;proto=https")
+	r.Header.Add("Forwarded", "for=192.0.2.43;proto=https;host=www.example.com")
+	if u := oid.RequestURL(r).String(); u != "https://www.example.com/cb" {
+		t.Errorf("Unexpected URL: %s", u)
+	}
+}
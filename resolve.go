@@ -0,0 +1,69 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Returns the URL of the document in resp, after redirects.
+func documentURL(resp *http.Response) *url.URL {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL
+	}
+	return &url.URL{}
+}
+
+// Resolves ref, a URL found in a document retrieved from base, and
+// makes sure the result is an absolute http or https URL. baseHref is
+// the href attribute of the document's <base> element, if any, and
+// takes precedence over base (it may itself be relative to base).
+func resolveURL(base *url.URL, baseHref, ref string) (string, error) {
+	if baseHref = strings.TrimSpace(baseHref); len(baseHref) > 0 {
+		b, err := base.Parse(baseHref)
+		if err != nil {
+			return "", err
+		}
+		base = b
+	}
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("Not an absolute http(s) URL: %s", ref)
+	}
+	return u.String(), nil
+}
+
+// Resolves localID, an OP-Local Identifier found in a document
+// retrieved from base, like resolveURL if it is a relative URL. Other
+// identifiers, such as XRIs or URIs of another scheme, are returned
+// untouched.
+func resolveLocalID(base *url.URL, baseHref, localID string) (string, error) {
+	localID = strings.TrimSpace(localID)
+	if len(localID) == 0 {
+		return "", nil
+	}
+	if b := localID[0]; b == '=' || b == '@' || b == '+' || b == '$' || b == '!' || b == '(' {
+		return localID, nil
+	}
+	if u, err := url.Parse(localID); err != nil || len(u.Scheme) > 0 {
+		return localID, nil
+	}
+	return resolveURL(base, baseHref, localID)
+}
+
+// Resolves the OP endpoint and OP-Local identifier found in the XRDS
+// document retrieved from base.
+func resolveDiscoveredInfo(info *SimpleDiscoveredInfo, base *url.URL) (*SimpleDiscoveredInfo, error) {
+	var err error
+	if info.opEndpoint, err = resolveURL(base, "", info.opEndpoint); err != nil {
+		return nil, err
+	}
+	if info.opLocalID, err = resolveLocalID(base, "", info.opLocalID); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,34 @@
+package openid
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestResolveURL(t *testing.T) {
+	base, _ := url.Parse("http://example.com/a/b?q=1")
+	doResolveURL(t, base, "", "http://other.com/x", "http://other.com/x", true)
+	doResolveURL(t, base, "", "c", "http://example.com/a/c", true)
+	doResolveURL(t, base, "", "/c", "http://example.com/c", true)
+	doResolveURL(t, base, "", "//other.com/c", "http://other.com/c", true)
+	doResolveURL(t, base, "", " c ", "http://example.com/a/c", true)
+
+	// <base href> has precedence, and can itself be relative.
+	doResolveURL(t, base, "https://b.com/d/", "c", "https://b.com/d/c", true)
+	doResolveURL(t, base, "/d/", "c", "http://example.com/d/c", true)
+
+	// Not http(s), or not absolute.
+	doResolveURL(t, base, "", "javascript:alert(1)", "", false)
+	doResolveURL(t, base, "", "mailto:foo@example.com", "", false)
+	doResolveURL(t, &url.URL{}, "", "c", "", false)
+	doResolveURL(t, &url.URL{}, "", "http:///c", "", false)
+}
+
+func doResolveURL(t *testing.T, base *url.URL, baseHref, ref, expected string, succeed bool) {
+	res, err := resolveURL(base, baseHref, ref)
+	if (err == nil) != succeed {
+		t.Errorf("Unexpected error resolving %s: %v", ref, err)
+	} else if res != expected {
+		t.Errorf("Unexpected result resolving %s: Expected %s, Got %s", ref, expected, res)
+	}
+}
@@ -0,0 +1,65 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// 13.  Discovering OpenID Relying Parties
+// Relying Party discovery allows software to discover sites where
+// the end user can use OpenID. [...] Relying Parties SHOULD use
+// Yadis to publish their valid return_to URLs. The Relying Party MAY
+// publish this information at any URL, and SHOULD make it available
+// from the realm URL.
+const returnToServiceType = "http://specs.openid.net/auth/2.0/return_to"
+
+// RelyingPartyXrdsHandler serves the XRDS document that OPs retrieve
+// when performing Relying Party discovery on the openid.realm. It
+// lists the return_to URLs the RP accepts assertions on.
+//
+// Serve it on some URL, and advertise it on the realm page with
+// SetXrdsLocation.
+type RelyingPartyXrdsHandler struct {
+	xrds []byte
+}
+
+// NewRelyingPartyXrdsHandler returns a handler publishing returnTo,
+// which must be absolute http(s) URLs, typically the callback URLs
+// given to RedirectURL.
+func NewRelyingPartyXrdsHandler(returnTo ...string) (*RelyingPartyXrdsHandler, error) {
+	if len(returnTo) == 0 {
+		return nil, errors.New("No return_to URL to publish")
+	}
+	xrd := &Xrd{}
+	for _, r := range returnTo {
+		u, err := url.Parse(r)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("return_to must be an absolute http(s) URL: " + r)
+		}
+		xrd.Service = append(xrd.Service, &XrdsIdentifier{
+			Type: []string{returnToServiceType},
+			URI:  r,
+		})
+	}
+	xrds, err := (&XrdsDocument{Xrd: []*Xrd{xrd}}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingPartyXrdsHandler{xrds: xrds}, nil
+}
+
+func (h *RelyingPartyXrdsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xrds+xml; charset=UTF-8")
+	w.Write(h.xrds)
+}
+
+// SetXrdsLocation sets the X-XRDS-Location header pointing to the
+// RP's XRDS document (see RelyingPartyXrdsHandler). Call it from the
+// handler of the realm URL, before writing the response body.
+func SetXrdsLocation(w http.ResponseWriter, xrdsURL string) {
+	w.Header().Set("X-XRDS-Location", xrdsURL)
+}
@@ -0,0 +1,66 @@
+package openid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelyingPartyXrdsHandler(t *testing.T) {
+	h, err := NewRelyingPartyXrdsHandler(
+		"https://rp.example.com/openid/callback",
+		"https://rp.example.com/other?a=1&b=2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "https://rp.example.com/xrds", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/xrds+xml; charset=UTF-8" {
+		t.Errorf("Unexpected Content-Type: %s", ct)
+	}
+
+	doc, err := parseXrdsDocument(w.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Could not parse the XRDS document: %s\n%s", err, w.Body.String())
+	}
+	services := doc.FinalXrd().Service
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(services))
+	}
+	for i, uri := range []string{
+		"https://rp.example.com/openid/callback",
+		"https://rp.example.com/other?a=1&b=2",
+	} {
+		if !services[i].hasType("http://specs.openid.net/auth/2.0/return_to") {
+			t.Errorf("Bad service type: %v", services[i].Type)
+		}
+		if services[i].URI != uri {
+			t.Errorf("Bad service URI: Expected %s, Got %s", uri, services[i].URI)
+		}
+	}
+}
+
+func TestRelyingPartyXrdsHandlerBadReturnTo(t *testing.T) {
+	for _, returnTo := range [][]string{
+		{},
+		{"/relative/callback"},
+		{"ftp://rp.example.com/callback"},
+	} {
+		if _, err := NewRelyingPartyXrdsHandler(returnTo...); err == nil {
+			t.Errorf("Expected an error for %v", returnTo)
+		}
+	}
+}
+
+func TestSetXrdsLocation(t *testing.T) {
+	realm := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetXrdsLocation(w, "https://rp.example.com/xrds")
+		w.Write([]byte("<html></html>"))
+	})
+	w := httptest.NewRecorder()
+	realm.ServeHTTP(w, httptest.NewRequest("GET", "https://rp.example.com/", nil))
+	if l := w.Header().Get("X-XRDS-Location"); l != "https://rp.example.com/xrds" {
+		t.Errorf("Unexpected X-XRDS-Location: %s", l)
+	}
+}
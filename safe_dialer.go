@@ -0,0 +1,220 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Identifiers are typed in by end users, so discovery may be used to
+// make the RP fetch internal resources (Server-Side Request Forgery).
+// NewSafeClient returns an *http.Client that refuses to connect to
+// such addresses, to be used with NewOpenID.
+
+// Ranges blocked by the safe dialer: "this" network, private,
+// shared (carrier-grade NAT), loopback, link-local (including cloud
+// metadata services at 169.254.169.254), benchmarking, reserved,
+// multicast and broadcast addresses, and the IPv6 ranges embedding
+// IPv4 addresses: 6to4 and its relays, and NAT64.
+var blockedNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"2002::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// SafeDialPolicy configures NewSafeDialer and NewSafeClient. The zero
+// value only allows http and https requests on ports 80 and 443, to
+// public addresses.
+type SafeDialPolicy struct {
+	// Defaults to http and https.
+	AllowedSchemes []string
+	// Defaults to 80 and 443.
+	AllowedPorts []int
+	// Networks exempted from the blocked ranges, e.g. a trusted
+	// internal OP.
+	AllowedNetworks []*net.IPNet
+	// Connection timeout. Defaults to 30 seconds.
+	DialTimeout time.Duration
+}
+
+// BlockedRequestError is returned when a request is refused by the
+// safe dialer or the safe client.
+type BlockedRequestError struct {
+	// The URL or address that was refused.
+	Target string
+	Reason string
+}
+
+func (e *BlockedRequestError) Error() string {
+	return fmt.Sprintf("openid: request to %s blocked: %s", e.Target, e.Reason)
+}
+
+func (p *SafeDialPolicy) schemeAllowed(scheme string) bool {
+	if len(p.AllowedSchemes) == 0 {
+		return scheme == "http" || scheme == "https"
+	}
+	for _, s := range p.AllowedSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *SafeDialPolicy) portAllowed(port int) bool {
+	if len(p.AllowedPorts) == 0 {
+		return port == 80 || port == 443
+	}
+	for _, allowed := range p.AllowedPorts {
+		if allowed == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks a resolved address.
+func (p *SafeDialPolicy) checkAddress(address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	if !p.portAllowed(port) {
+		return &BlockedRequestError{Target: address, Reason: "port not allowed"}
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &BlockedRequestError{Target: address, Reason: "not an IP address"}
+	}
+	for _, n := range p.AllowedNetworks {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return &BlockedRequestError{Target: address, Reason: "address in blocked range " + n.String()}
+		}
+	}
+	return nil
+}
+
+// NewSafeDialer returns a dialer that refuses to connect to blocked
+// addresses. The check is done after DNS resolution, on the address
+// actually connected to, so it also applies to redirects, and host
+// names resolving to internal addresses.
+func NewSafeDialer(policy *SafeDialPolicy) *net.Dialer {
+	if policy == nil {
+		policy = &SafeDialPolicy{}
+	}
+	timeout := policy.DialTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return policy.checkAddress(address)
+		},
+	}
+}
+
+// NewSafeClient returns an *http.Client using NewSafeDialer, that
+// also checks the scheme and port of every request, including
+// redirects. Proxies from the environment are not used, as the
+// dialer would only check the address of the proxy.
+func NewSafeClient(policy *SafeDialPolicy) *http.Client {
+	if policy == nil {
+		policy = &SafeDialPolicy{}
+	}
+	dialer := NewSafeDialer(policy)
+	return &http.Client{
+		Transport: &safeTransport{
+			policy: policy,
+			base: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		},
+	}
+}
+
+type safeTransport struct {
+	policy *SafeDialPolicy
+	base   http.RoundTripper
+}
+
+func (t *safeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.check(req); err != nil {
+		// RoundTrip must always close the body.
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (t *safeTransport) check(req *http.Request) error {
+	u := req.URL
+	if !t.policy.schemeAllowed(u.Scheme) {
+		return &BlockedRequestError{Target: u.String(), Reason: "scheme not allowed"}
+	}
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if p := u.Port(); len(p) > 0 {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil {
+			return errors.New("Invalid port: " + p)
+		}
+	}
+	if !t.policy.portAllowed(port) {
+		return &BlockedRequestError{Target: u.String(), Reason: "port not allowed"}
+	}
+	return nil
+}
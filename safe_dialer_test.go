@@ -0,0 +1,113 @@
+package openid
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func serverPort(t *testing.T, server *httptest.Server) int {
+	u, _ := url.Parse(server.URL)
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("Bad server URL: %s", server.URL)
+	}
+	return port
+}
+
+func expectBlocked(t *testing.T, err error) {
+	var blocked *BlockedRequestError
+	if !errors.As(err, &blocked) {
+		t.Errorf("Expected a BlockedRequestError, got %v", err)
+	}
+}
+
+func TestSafeClientBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	// Port not allowed.
+	_, err := NewSafeClient(nil).Get(server.URL)
+	expectBlocked(t, err)
+
+	// Port allowed, but loopback address.
+	_, err = NewSafeClient(&SafeDialPolicy{AllowedPorts: []int{port}}).Get(server.URL)
+	expectBlocked(t, err)
+
+	// Loopback explicitly allowed.
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	resp, err := NewSafeClient(&SafeDialPolicy{
+		AllowedPorts:    []int{port},
+		AllowedNetworks: []*net.IPNet{loopback},
+	}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSafeClientBlocksRedirects(t *testing.T) {
+	var target string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	client := NewSafeClient(&SafeDialPolicy{
+		AllowedPorts:    []int{port},
+		AllowedNetworks: []*net.IPNet{loopback},
+	})
+	for _, target = range []string{
+		"http://169.254.169.254:" + strconv.Itoa(port) + "/latest/meta-data/",
+		"http://10.0.0.1:" + strconv.Itoa(port) + "/",
+		"http://example.com:22/",
+		"ftp://example.com/",
+	} {
+		_, err := client.Get(server.URL)
+		expectBlocked(t, err)
+	}
+}
+
+func TestSafeClientDiscovery(t *testing.T) {
+	oid := NewOpenID(NewSafeClient(nil))
+	_, _, _, err := oid.Discover("http://169.254.169.254/")
+	expectBlocked(t, err)
+}
+
+func TestSafeDialPolicyAddresses(t *testing.T) {
+	p := &SafeDialPolicy{}
+	for address, blocked := range map[string]bool{
+		"8.8.8.8:80":              false,
+		"[2001:4860::8888]:443":   false,
+		"8.8.8.8:8080":            true,
+		"127.0.0.1:80":            true,
+		"0.0.0.0:80":              true,
+		"10.1.2.3:80":             true,
+		"172.16.0.1:80":           true,
+		"192.168.1.1:80":          true,
+		"100.64.0.1:80":           true,
+		"169.254.169.254:80":      true,
+		"[::1]:80":                true,
+		"[::ffff:127.0.0.1]:80":   true,
+		"[fd00:ec2::254]:80":      true,
+		"[fe80::1]:80":            true,
+		"[::ffff:169.254.1.1]:80": true,
+		"[::]:80":                 true,
+		"192.88.99.1:80":          true,
+		"[2002:a00:1::1]:80":      true,
+		"[64:ff9b::a00:1]:80":     true,
+		"[64:ff9b:1::a00:1]:80":   true,
+	} {
+		err := p.checkAddress(address)
+		if (err != nil) != blocked {
+			t.Errorf("%s: expected blocked=%v, got %v", address, blocked, err)
+		}
+	}
+}
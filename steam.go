@@ -0,0 +1,141 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SteamOPEndpoint is the OP Endpoint URL of Steam.
+const SteamOPEndpoint = "https://steamcommunity.com/openid/login"
+
+// The claimed identifiers asserted by Steam are this prefix followed
+// by the SteamID64 of the end user.
+const steamClaimedIDPrefix = "https://steamcommunity.com/openid/id/"
+
+// SteamID64 is the 64-bit representation of a Steam account ID, as
+// found in the claimed identifiers asserted by Steam. From the lowest
+// bits: the 32-bit account number, a 20-bit instance, a 4-bit account
+// type and an 8-bit universe.
+type SteamID64 uint64
+
+const (
+	steamUniversePublic   = 1
+	steamTypeIndividual   = 1
+	steamInstanceDesktop  = 1
+	steamIndividualPublic = SteamID64(steamUniversePublic)<<56 |
+		SteamID64(steamTypeIndividual)<<52 |
+		SteamID64(steamInstanceDesktop)<<32
+)
+
+// NewSteamID64 returns the SteamID64 of the individual account number
+// accountID in the public universe.
+func NewSteamID64(accountID uint32) SteamID64 {
+	return steamIndividualPublic | SteamID64(accountID)
+}
+
+// ParseSteamID64 parses the decimal representation of a SteamID64.
+func ParseSteamID64(s string) (SteamID64, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSteamID, s)
+	}
+	return SteamID64(id), nil
+}
+
+// SteamIDFromClaimedID returns the SteamID64 of a claimed identifier
+// asserted by Steam. It must be the identifier of an individual
+// account of the public universe.
+func SteamIDFromClaimedID(claimedID string) (SteamID64, error) {
+	if !strings.HasPrefix(claimedID, steamClaimedIDPrefix) {
+		return 0, fmt.Errorf("%w: not a Steam claimed identifier: %s", ErrInvalidSteamID, claimedID)
+	}
+	digits := strings.TrimPrefix(claimedID, steamClaimedIDPrefix)
+	if len(digits) == 0 || len(digits) > 20 || strings.TrimLeft(digits, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSteamID, claimedID)
+	}
+	id, err := ParseSteamID64(digits)
+	if err != nil {
+		return 0, err
+	}
+	if id.Universe() != steamUniversePublic || id.Type() != steamTypeIndividual || id.AccountID() == 0 {
+		return 0, fmt.Errorf("%w: not an individual account: %s", ErrInvalidSteamID, claimedID)
+	}
+	return id, nil
+}
+
+// AccountID returns the 32-bit account number, also known as the
+// SteamID32.
+func (id SteamID64) AccountID() uint32 {
+	return uint32(id)
+}
+
+// Instance returns the instance: 1 for desktop logins of individual
+// accounts.
+func (id SteamID64) Instance() uint32 {
+	return uint32(id>>32) & 0xfffff
+}
+
+// Type returns the account type: 1 for individual accounts.
+func (id SteamID64) Type() uint8 {
+	return uint8(id>>52) & 0xf
+}
+
+// Universe returns the universe: 1 for the public universe.
+func (id SteamID64) Universe() uint8 {
+	return uint8(id >> 56)
+}
+
+// String returns the decimal representation of the SteamID64.
+func (id SteamID64) String() string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// SteamID2 returns the legacy textual representation
+// "STEAM_X:Y:Z", where X is the universe, Y the lowest bit of the
+// account number and Z the rest of it. Note that some games display 0
+// instead of 1 for the public universe.
+func (id SteamID64) SteamID2() string {
+	account := id.AccountID()
+	return fmt.Sprintf("STEAM_%d:%d:%d", id.Universe(), account&1, account>>1)
+}
+
+// SteamID3 returns the representation "[U:1:Z]" of individual
+// accounts, where 1 is the universe and Z the account number.
+func (id SteamID64) SteamID3() string {
+	return fmt.Sprintf("[U:%d:%d]", id.Universe(), id.AccountID())
+}
+
+// ProfileURL returns the URL of the Steam Community profile.
+func (id SteamID64) ProfileURL() string {
+	return "https://steamcommunity.com/profiles/" + id.String()
+}
+
+// VerifySteam is like VerifyAssertion (tx is optional), for assertions
+// from Steam only: it returns the SteamID64 of the end user. Assertions
+// from another OP are refused with an *EndpointError before any
+// request.
+func VerifySteam(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (SteamID64, error) {
+	return defaultInstance.VerifySteam(r, tx, cache, nonceStore)
+}
+
+func (oid *OpenID) VerifySteam(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (SteamID64, error) {
+	if err := r.ParseForm(); err != nil {
+		return 0, err
+	}
+	// Negative assertions have no OP Endpoint URL.
+	if mode := r.Form.Get("openid.mode"); mode == "id_res" {
+		if endpoint := r.Form.Get("openid.op_endpoint"); endpoint != SteamOPEndpoint {
+			return 0, &EndpointError{Endpoint: endpoint}
+		}
+	}
+	a, err := oid.VerifyAssertion(r, tx, cache, nonceStore)
+	if err != nil {
+		return 0, err
+	}
+	if a.OpEndpoint != SteamOPEndpoint {
+		return 0, &EndpointError{Endpoint: a.OpEndpoint}
+	}
+	return SteamIDFromClaimedID(a.ClaimedID)
+}
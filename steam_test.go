@@ -0,0 +1,139 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSteamID64(t *testing.T) {
+	id := SteamID64(76561197960287930)
+	if got := id.AccountID(); got != 22202 {
+		t.Errorf("AccountID = %d", got)
+	}
+	if id.Universe() != 1 || id.Type() != 1 || id.Instance() != 1 {
+		t.Errorf("Unexpected universe/type/instance: %d/%d/%d", id.Universe(), id.Type(), id.Instance())
+	}
+	if got := id.String(); got != "76561197960287930" {
+		t.Errorf("String = %s", got)
+	}
+	if got := id.SteamID2(); got != "STEAM_1:0:11101" {
+		t.Errorf("SteamID2 = %s", got)
+	}
+	if got := id.SteamID3(); got != "[U:1:22202]" {
+		t.Errorf("SteamID3 = %s", got)
+	}
+	if got := id.ProfileURL(); got != "https://steamcommunity.com/profiles/76561197960287930" {
+		t.Errorf("ProfileURL = %s", got)
+	}
+	if got := NewSteamID64(22202); got != id {
+		t.Errorf("NewSteamID64 = %d", got)
+	}
+	if got := NewSteamID64(1).SteamID2(); got != "STEAM_1:1:0" {
+		t.Errorf("SteamID2 = %s", got)
+	}
+}
+
+func TestSteamIDFromClaimedID(t *testing.T) {
+	id, err := SteamIDFromClaimedID("https://steamcommunity.com/openid/id/76561197960287930")
+	if err != nil || id != 76561197960287930 {
+		t.Errorf("Unexpected result: %d, %v", id, err)
+	}
+
+	for _, claimedID := range []string{
+		"",
+		"76561197960287930",
+		"http://steamcommunity.com/openid/id/76561197960287930",
+		"https://steamcommunity.com.example.com/openid/id/76561197960287930",
+		"https://steamcommunity.com/openid/id/",
+		"https://steamcommunity.com/openid/id/+76561197960287930",
+		"https://steamcommunity.com/openid/id/7656119796028793a",
+		"https://steamcommunity.com/openid/id/76561197960287930/",
+		"https://steamcommunity.com/openid/id/76561197960287930?x=1",
+		"https://steamcommunity.com/openid/id/99999999999999999999",
+		// Account number 0.
+		"https://steamcommunity.com/openid/id/76561197960265728",
+		// Clan account.
+		"https://steamcommunity.com/openid/id/103582791429521412",
+		// Beta universe.
+		"https://steamcommunity.com/openid/id/148618792002454458",
+	} {
+		if _, err := SteamIDFromClaimedID(claimedID); !errors.Is(err, ErrInvalidSteamID) {
+			t.Errorf("%q: expected an invalid Steam ID, got %v", claimedID, err)
+		}
+	}
+}
+
+// steamGetter sends the requests to steamcommunity.com to a test server.
+type steamGetter struct {
+	getter HTTPGetter
+	server *httptest.Server
+}
+
+func (g *steamGetter) rewrite(uri string) string {
+	return strings.Replace(uri, "https://steamcommunity.com", g.server.URL, 1)
+}
+
+func (g *steamGetter) Get(ctx context.Context, uri string, headers map[string]string) (*http.Response, error) {
+	return g.getter.Get(ctx, g.rewrite(uri), headers)
+}
+
+func (g *steamGetter) Head(ctx context.Context, uri string, headers map[string]string) (*http.Response, error) {
+	return g.getter.Head(ctx, g.rewrite(uri), headers)
+}
+
+func (g *steamGetter) Post(ctx context.Context, uri string, form url.Values) (*http.Response, error) {
+	return g.getter.Post(ctx, g.rewrite(uri), form)
+}
+
+func TestVerifySteam(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openid/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ns:http://specs.openid.net/auth/2.0\nis_valid:true\n"))
+	})
+	mux.Handle("/openid/id/", &IdentityPage{OpEndpoint: SteamOPEndpoint})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	recorder := &recordingGetter{getter: &steamGetter{NewHTTPGetter(server.Client()), server}}
+	oid := NewOpenIDWithGetter(recorder)
+
+	verify := func(vals url.Values) (SteamID64, error) {
+		r := httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil)
+		return oid.VerifySteam(r, nil, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	}
+
+	id, err := verify(errorsTestAssertion(SteamOPEndpoint, "https://steamcommunity.com/openid/id/76561197960287930"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != 76561197960287930 {
+		t.Errorf("Unexpected Steam ID: %d", id)
+	}
+
+	_, err = verify(errorsTestAssertion(SteamOPEndpoint, "https://steamcommunity.com/openid/id/103582791429521412"))
+	if !errors.Is(err, ErrInvalidSteamID) {
+		t.Errorf("Expected an invalid Steam ID, got %v", err)
+	}
+
+	// Assertions from another OP are refused without any request.
+	recorder.requests = nil
+	vals := errorsTestAssertion(SteamOPEndpoint, "https://steamcommunity.com/openid/id/76561197960287930")
+	vals.Set("openid.op_endpoint", "https://op.example.com/server")
+	_, err = verify(vals)
+	var endpointErr *EndpointError
+	if !errors.As(err, &endpointErr) || endpointErr.Endpoint != "https://op.example.com/server" {
+		t.Errorf("Expected an *EndpointError, got %v", err)
+	}
+	if len(recorder.requests) != 0 {
+		t.Errorf("Unexpected requests: %v", recorder.requests)
+	}
+
+	vals = url.Values{"openid.ns": {"http://specs.openid.net/auth/2.0"}, "openid.mode": {"cancel"}}
+	if _, err = verify(vals); !errors.Is(err, ErrCanceled) {
+		t.Errorf("Expected ErrCanceled, got %v", err)
+	}
+}
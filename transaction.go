@@ -0,0 +1,186 @@
+package openid
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The query parameter of the return_to URL holding the state of the
+// transaction.
+const stateParam = "rp_state"
+
+// Transaction is an authentication transaction, from the redirection
+// of the end user to the OP until the verification of the assertion
+// sent back. Transactions started with StartTransaction also remember
+// the information discovered from the User-Supplied Identifier: the
+// assertion is then verified against it (11.2), without discovering
+// the identifier again.
+type Transaction struct {
+	// State is a random token added to the return_to URL. Only the
+	// browser that started the transaction has it in its
+	// TransactionStore: this prevents an attacker from completing a
+	// login in the victim's browser with their own assertion.
+	State   string
+	Created time.Time
+
+	// The identifier entered by the end user.
+	UserSuppliedID string `json:",omitempty"`
+	// The discovered information. ClaimedID is empty if the end user
+	// entered an OP Identifier.
+	ClaimedID  string    `json:",omitempty"`
+	OpEndpoint string    `json:",omitempty"`
+	OpLocalID  string    `json:",omitempty"`
+	Expires    time.Time `json:",omitempty"`
+}
+
+// NewTransaction starts a transaction with a random state.
+func NewTransaction() (*Transaction, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &Transaction{State: hex.EncodeToString(random), Created: time.Now()}, nil
+}
+
+// Returns the openid.identity expected in the assertion for the
+// discovered claimed identifier (9.1).
+func (tx *Transaction) identity() string {
+	if len(tx.OpLocalID) > 0 {
+		return tx.OpLocalID
+	}
+	return tx.ClaimedID
+}
+
+// ReturnTo returns callbackURL with the state of the transaction.
+func (tx *Transaction) ReturnTo(callbackURL string) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(stateParam, tx.State)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// TransactionStore binds transactions to the browser that started
+// them, with a cookie or a session for example.
+type TransactionStore interface {
+	// Save stores tx for the browser of r.
+	Save(w http.ResponseWriter, r *http.Request, tx *Transaction) error
+	// Load returns the transaction with this state, if it was started
+	// by the browser of r, and forgets it. It returns an error
+	// wrapping ErrStateMismatch otherwise.
+	Load(w http.ResponseWriter, r *http.Request, state string) (*Transaction, error)
+}
+
+// CookieTransactionStore stores each transaction in a cookie, signed
+// with HMAC-SHA256 so that it can't be forged.
+type CookieTransactionStore struct {
+	// Key signs the cookies. All the servers of a Relying Party must
+	// use the same key.
+	Key []byte
+	// Prefix of the cookie names, followed by the state.
+	Name   string
+	Path   string
+	Domain string
+	// MaxAge is the maximum duration of a transaction, 10 minutes if
+	// zero.
+	MaxAge time.Duration
+	Secure bool
+	// With the default SameSite=Lax, the cookie is not sent with
+	// assertions POSTed by the OP (see Redirect). Use SameSite=None
+	// (which requires Secure) to support them.
+	SameSite http.SameSite
+}
+
+const defaultTransactionMaxAge = 10 * time.Minute
+
+// NewCookieTransactionStore returns a CookieTransactionStore signing
+// its cookies with key. Transactions last at most 10 minutes.
+func NewCookieTransactionStore(key []byte) *CookieTransactionStore {
+	return &CookieTransactionStore{
+		Key:      key,
+		Name:     "openid_tx_",
+		Path:     "/",
+		MaxAge:   defaultTransactionMaxAge,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *CookieTransactionStore) Save(w http.ResponseWriter, r *http.Request, tx *Transaction) error {
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	name := s.Name + tx.State
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value + "." + s.sign(name, value),
+		Path:     s.Path,
+		Domain:   s.Domain,
+		MaxAge:   int(s.maxAge().Seconds()),
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: s.SameSite,
+	})
+	return nil
+}
+
+func (s *CookieTransactionStore) Load(w http.ResponseWriter, r *http.Request, state string) (*Transaction, error) {
+	name := s.Name + state
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no transaction cookie", ErrStateMismatch)
+	}
+	// The transaction can only be used once.
+	http.SetCookie(w, &http.Cookie{
+		Name:   name,
+		Path:   s.Path,
+		Domain: s.Domain,
+		MaxAge: -1,
+	})
+
+	i := strings.LastIndex(cookie.Value, ".")
+	if i < 0 || !hmac.Equal([]byte(cookie.Value[i+1:]), []byte(s.sign(name, cookie.Value[:i]))) {
+		return nil, fmt.Errorf("%w: invalid transaction cookie signature", ErrStateMismatch)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(cookie.Value[:i])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStateMismatch, err)
+	}
+	tx := &Transaction{}
+	if err := json.Unmarshal(payload, tx); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStateMismatch, err)
+	}
+	if tx.State != state {
+		return nil, fmt.Errorf("%w: transaction cookie for another state", ErrStateMismatch)
+	}
+	if time.Since(tx.Created) > s.maxAge() {
+		return nil, fmt.Errorf("%w: transaction expired", ErrStateMismatch)
+	}
+	return tx, nil
+}
+
+func (s *CookieTransactionStore) maxAge() time.Duration {
+	if s.MaxAge > 0 {
+		return s.MaxAge
+	}
+	return defaultTransactionMaxAge
+}
+
+func (s *CookieTransactionStore) sign(name, value string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
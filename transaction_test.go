@@ -0,0 +1,146 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTransactionReturnTo(t *testing.T) {
+	tx := &Transaction{State: "abc"}
+	returnTo, err := tx.ReturnTo("http://rp.example.com/callback?a=b")
+	if err != nil || returnTo != "http://rp.example.com/callback?a=b&rp_state=abc" {
+		t.Errorf("Unexpected return_to: %s, %v", returnTo, err)
+	}
+}
+
+func TestCookieTransactionStore(t *testing.T) {
+	store := NewCookieTransactionStore([]byte("key"))
+	tx, err := NewTransaction()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	w := httptest.NewRecorder()
+	if err = store.Save(w, httptest.NewRequest("GET", "/login", nil), tx); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	r := httptest.NewRequest("GET", "/callback", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	loaded, err := store.Load(w, r, tx.State)
+	if err != nil || loaded.State != tx.State || !loaded.Created.Equal(tx.Created) {
+		t.Errorf("Unexpected transaction: %v, %v", loaded, err)
+	}
+	// The cookie is deleted.
+	if deleted := w.Result().Cookies(); len(deleted) != 1 || deleted[0].MaxAge >= 0 {
+		t.Errorf("Unexpected cookies: %v", deleted)
+	}
+
+	// Signed with another key.
+	other := NewCookieTransactionStore([]byte("other key"))
+	if _, err = other.Load(httptest.NewRecorder(), r, tx.State); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Expected a state mismatch, got %v", err)
+	}
+
+	// Expired.
+	store.MaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err = store.Load(httptest.NewRecorder(), r, tx.State); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Expected a state mismatch, got %v", err)
+	}
+}
+
+func TestCookieTransactionStoreZeroMaxAge(t *testing.T) {
+	store := &CookieTransactionStore{Key: []byte("key")}
+	tx, err := NewTransaction()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	w := httptest.NewRecorder()
+	if err = store.Save(w, httptest.NewRequest("GET", "/login", nil), tx); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	if cookie.MaxAge != 600 {
+		t.Errorf("Unexpected cookie MaxAge: %d", cookie.MaxAge)
+	}
+
+	r := httptest.NewRequest("GET", "/callback", nil)
+	r.AddCookie(cookie)
+	if loaded, err := store.Load(httptest.NewRecorder(), r, tx.State); err != nil || loaded.State != tx.State {
+		t.Errorf("Unexpected transaction: %v, %v", loaded, err)
+	}
+}
+
+func TestStartTransaction(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	recorder := &recordingGetter{getter: NewHTTPGetter(server.Client())}
+	oid := NewOpenIDWithGetter(recorder)
+
+	tx, redirectURL, err := oid.StartTransaction(context.Background(), server.URL+"/id", "http://rp.example.com/return", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if tx.UserSuppliedID != server.URL+"/id" || tx.ClaimedID != server.URL+"/id" ||
+		tx.OpEndpoint != server.URL+"/op" || len(tx.State) == 0 {
+		t.Errorf("Unexpected transaction: %+v", tx)
+	}
+	u, _ := url.Parse(redirectURL)
+	returnTo := u.Query().Get("openid.return_to")
+	if returnTo != "http://rp.example.com/return?rp_state="+tx.State {
+		t.Errorf("Unexpected return_to: %s", returnTo)
+	}
+
+	callback := func(vals url.Values) *http.Request {
+		vals.Set("openid.return_to", returnTo)
+		return httptest.NewRequest("GET", returnTo+"&"+vals.Encode(), nil)
+	}
+
+	// The claimed identifier is not discovered again.
+	recorder.requests = nil
+	id, err := oid.VerifyTransaction(callback(errorsTestAssertion(server.URL+"/op", server.URL+"/id")), tx,
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if err != nil || id != server.URL+"/id" {
+		t.Errorf("Unexpected verification: %s, %v", id, err)
+	}
+	if len(recorder.requests) != 1 || recorder.requests[0] != "POST "+server.URL+"/op" {
+		t.Errorf("Unexpected requests: %v", recorder.requests)
+	}
+
+	// Another claimed identifier is discovered.
+	recorder.requests = nil
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id#fragment")
+	vals.Set("openid.identity", server.URL+"/id")
+	if _, err = oid.VerifyTransaction(callback(vals), tx, NewSimpleDiscoveryCache(), NewSimpleNonceStore()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	vals = errorsTestAssertion(server.URL+"/op", server.URL+"/other")
+	if _, err = oid.VerifyTransaction(callback(vals), tx, NewSimpleDiscoveryCache(), NewSimpleNonceStore()); !errors.Is(err, ErrDiscoveredInfoMismatch) {
+		t.Errorf("Expected a discovered information mismatch, got %v", err)
+	}
+
+	// The OP was swapped.
+	swapped := *tx
+	swapped.OpEndpoint = "https://op.example.com/server"
+	_, err = oid.VerifyTransaction(callback(errorsTestAssertion(server.URL+"/op", server.URL+"/id")), &swapped,
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if !errors.Is(err, ErrEndpointMismatch) || !errors.Is(err, ErrDiscoveredInfoMismatch) {
+		t.Errorf("Expected an endpoint mismatch, got %v", err)
+	}
+
+	// Callback of another transaction.
+	other := *tx
+	other.State = "other"
+	_, err = oid.VerifyTransaction(callback(errorsTestAssertion(server.URL+"/op", server.URL+"/id")), &other,
+		NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Expected a state mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package openid
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnsolicitedPolicy tells which unsolicited positive assertions are
+// accepted: assertions sent by an OP without an authentication request
+// from the Relying Party (10).
+//
+// An assertion is solicited if it is verified with the transaction
+// that requested it (VerifyTransaction, VerifyAssertion with a
+// transaction, or RelyingParty with a TransactionStore). Otherwise, it
+// is only considered solicited if RedirectURLWithCache recorded a
+// request for its claimed identifier and OP Endpoint URL in
+// OpenID.Solicitations, and each request only solicits one assertion.
+// Logins with an OP Identifier have no claimed identifier before the
+// assertion: with AllowlistUnsolicited or RejectUnsolicited, they need
+// transactions.
+type UnsolicitedPolicy int
+
+const (
+	// AcceptUnsolicited accepts all unsolicited assertions, after
+	// discovering their claimed identifier.
+	AcceptUnsolicited UnsolicitedPolicy = iota
+	// RejectUnsolicited rejects all unsolicited assertions.
+	RejectUnsolicited
+	// AllowlistUnsolicited only accepts unsolicited assertions from
+	// the OP Endpoint URLs of OpenID.UnsolicitedEndpoints.
+	AllowlistUnsolicited
+)
+
+// SolicitationStore remembers the authentication requests sent
+// without a transaction, by RedirectURLWithCache.
+type SolicitationStore interface {
+	// Add records a request about claimedID, sent to endpoint.
+	Add(claimedID, endpoint string)
+	// Consume reports whether a request about claimedID was sent to
+	// endpoint, and forgets it.
+	Consume(claimedID, endpoint string) bool
+}
+
+// Requests are forgotten after this duration.
+const solicitationLifetime = 10 * time.Minute
+
+type solicitation struct {
+	endpoint string
+	expires  time.Time
+}
+
+type SimpleSolicitationStore struct {
+	store map[string][]solicitation
+	mutex *sync.Mutex
+}
+
+func NewSimpleSolicitationStore() *SimpleSolicitationStore {
+	return &SimpleSolicitationStore{store: map[string][]solicitation{}, mutex: &sync.Mutex{}}
+}
+
+func (s *SimpleSolicitationStore) Add(claimedID, endpoint string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	// Delete old requests while we are at it.
+	for id, requests := range s.store {
+		s.store[id] = unexpiredSolicitations(requests, now)
+		if len(s.store[id]) == 0 {
+			delete(s.store, id)
+		}
+	}
+	s.store[claimedID] = append(s.store[claimedID], solicitation{endpoint, now.Add(solicitationLifetime)})
+}
+
+func (s *SimpleSolicitationStore) Consume(claimedID, endpoint string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := unexpiredSolicitations(s.store[claimedID], time.Now())
+	for i, r := range requests {
+		if r.endpoint == endpoint {
+			requests = append(requests[:i], requests[i+1:]...)
+			if len(requests) == 0 {
+				delete(s.store, claimedID)
+			} else {
+				s.store[claimedID] = requests
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func unexpiredSolicitations(requests []solicitation, now time.Time) []solicitation {
+	var kept []solicitation
+	for _, r := range requests {
+		if now.Before(r.expires) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Returns an error wrapping ErrUnsolicited if the assertion in vals is
+// unsolicited, and refused by the policy.
+func (oid *OpenID) checkUnsolicited(vals url.Values, tx *Transaction) error {
+	if tx != nil || oid.Unsolicited == AcceptUnsolicited {
+		return nil
+	}
+	endpoint := vals.Get("openid.op_endpoint")
+	claimedID := vals.Get("openid.claimed_id")
+	if i := strings.Index(claimedID, "#"); i != -1 {
+		claimedID = claimedID[:i]
+	}
+	if len(claimedID) > 0 && oid.Solicitations != nil && oid.Solicitations.Consume(claimedID, endpoint) {
+		return nil
+	}
+	if oid.Unsolicited == AllowlistUnsolicited {
+		for _, allowed := range oid.UnsolicitedEndpoints {
+			if allowed == endpoint {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w from %s", ErrUnsolicited, endpoint)
+}
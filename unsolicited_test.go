@@ -0,0 +1,111 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnsolicitedPolicy(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	recorder := &recordingGetter{getter: NewHTTPGetter(server.Client())}
+	oid := NewOpenIDWithGetter(recorder)
+
+	verify := func(cache DiscoveryCache) error {
+		vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+		_, err := oid.VerifyRequest(httptest.NewRequest("GET", "http://rp.example.com/return?"+vals.Encode(), nil),
+			cache, NewSimpleNonceStore())
+		return err
+	}
+
+	if err := verify(NewSimpleDiscoveryCache()); err != nil {
+		t.Errorf("Unsolicited assertion rejected by default: %v", err)
+	}
+
+	oid.Unsolicited = RejectUnsolicited
+	recorder.requests = nil
+	if err := verify(NewSimpleDiscoveryCache()); !errors.Is(err, ErrUnsolicited) {
+		t.Errorf("Expected an unsolicited assertion, got %v", err)
+	}
+	if len(recorder.requests) != 0 {
+		t.Errorf("Unexpected requests: %v", recorder.requests)
+	}
+
+	// A cached claimed identifier does not make an assertion
+	// solicited.
+	cache := NewSimpleDiscoveryCache()
+	cache.Put(server.URL+"/id", &SimpleDiscoveredInfo{
+		opEndpoint: server.URL + "/op",
+		opLocalID:  server.URL + "/id",
+		claimedID:  server.URL + "/id",
+	})
+	if err := verify(cache); !errors.Is(err, ErrUnsolicited) {
+		t.Errorf("Expected an unsolicited assertion, got %v", err)
+	}
+
+	// Requested with RedirectURLWithCache, once.
+	cache = NewSimpleDiscoveryCache()
+	if _, err := oid.RedirectURLWithCache(context.Background(), server.URL+"/id", "http://rp.example.com/return", "", cache); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := verify(cache); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	// After a login, another assertion about the same identifier is
+	// still unsolicited.
+	if err := verify(cache); !errors.Is(err, ErrUnsolicited) {
+		t.Errorf("Expected an unsolicited assertion, got %v", err)
+	}
+
+	oid.Unsolicited = AllowlistUnsolicited
+	oid.UnsolicitedEndpoints = []string{"https://op.example.com/server"}
+	if err := verify(NewSimpleDiscoveryCache()); !errors.Is(err, ErrUnsolicited) {
+		t.Errorf("Expected an unsolicited assertion, got %v", err)
+	}
+	oid.UnsolicitedEndpoints = append(oid.UnsolicitedEndpoints, server.URL+"/op")
+	if err := verify(NewSimpleDiscoveryCache()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestUnsolicitedPolicyTransaction(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	oid := NewOpenID(server.Client())
+	oid.Unsolicited = RejectUnsolicited
+
+	// Identifier select: the claimed identifier is only known from the
+	// assertion, but the transaction requested it.
+	tx := &Transaction{State: "state", OpEndpoint: server.URL + "/op"}
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	vals.Set("openid.return_to", "http://rp.example.com/return?rp_state=state")
+	r := httptest.NewRequest("GET", "http://rp.example.com/return?rp_state=state&"+vals.Encode(), nil)
+	if _, err := oid.VerifyTransaction(r, tx, NewSimpleDiscoveryCache(), NewSimpleNonceStore()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSimpleSolicitationStore(t *testing.T) {
+	s := NewSimpleSolicitationStore()
+	s.Add("http://example.com/id", "https://op.example.com/server")
+	s.Add("http://example.com/id", "https://op.example.com/server")
+	if s.Consume("http://example.com/id", "https://other.example.com/server") {
+		t.Errorf("Consumed a request to another OP")
+	}
+	for i := 0; i < 2; i++ {
+		if !s.Consume("http://example.com/id", "https://op.example.com/server") {
+			t.Errorf("Request %d not recorded", i)
+		}
+	}
+	if s.Consume("http://example.com/id", "https://op.example.com/server") {
+		t.Errorf("Request consumed three times")
+	}
+
+	s.store["http://example.com/old"] = []solicitation{{"https://op.example.com/server", time.Now().Add(-time.Second)}}
+	if s.Consume("http://example.com/old", "https://op.example.com/server") {
+		t.Errorf("Consumed an expired request")
+	}
+}
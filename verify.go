@@ -1,11 +1,13 @@
 package openid
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 func Verify(uri string, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
@@ -13,6 +15,11 @@ func Verify(uri string, cache DiscoveryCache, nonceStore NonceStore) (id string,
 }
 
 func (oid *OpenID) Verify(uri string, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
+	return oid.VerifyContext(context.Background(), uri, cache, nonceStore)
+}
+
+// VerifyContext is like Verify, with a context for the HTTP requests.
+func (oid *OpenID) VerifyContext(ctx context.Context, uri string, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
 	parsedURL, err := url.Parse(uri)
 	if err != nil {
 		return "", err
@@ -21,6 +28,57 @@ func (oid *OpenID) Verify(uri string, cache DiscoveryCache, nonceStore NonceStor
 	if err != nil {
 		return "", err
 	}
+	return claimedID(oid.verify(ctx, parsedURL, values, nil, cache, nonceStore))
+}
+
+// VerifyRequest is like Verify, for the callback request r itself. The
+// URL the request was sent to is reconstructed with RequestURL, and
+// the assertion may be in the query or, for POST requests, in the
+// form body.
+func VerifyRequest(r *http.Request, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
+	return defaultInstance.VerifyRequest(r, cache, nonceStore)
+}
+
+func (oid *OpenID) VerifyRequest(r *http.Request, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
+	return claimedID(oid.VerifyAssertion(r, nil, cache, nonceStore))
+}
+
+// VerifyTransaction is like VerifyRequest, for a callback request of
+// the transaction tx, as returned by StartTransaction and then loaded
+// from a TransactionStore. The assertion must come from the OP the end
+// user was sent to. If it is about the discovered claimed identifier,
+// it is verified against the information of the transaction instead
+// of discovering the identifier again.
+func VerifyTransaction(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
+	return defaultInstance.VerifyTransaction(r, tx, cache, nonceStore)
+}
+
+func (oid *OpenID) VerifyTransaction(r *http.Request, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (id string, err error) {
+	return claimedID(oid.VerifyAssertion(r, tx, cache, nonceStore))
+}
+
+// Returns the claimed identifier of a verified assertion. Assertions
+// that are not about an identifier are rejected.
+func claimedID(a *Assertion, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if !a.IsIdentity() {
+		return "", fmt.Errorf("%w: no claimed_id to verify", ErrInvalidAssertion)
+	}
+	return a.ClaimedID, nil
+}
+
+// Verifies the assertion in values, received at uri, for the
+// transaction tx if not nil.
+func (oid *OpenID) verify(ctx context.Context, uri *url.URL, values url.Values, tx *Transaction, cache DiscoveryCache, nonceStore NonceStore) (a *Assertion, err error) {
+	// 10.2.  Negative Assertions
+	switch values.Get("openid.mode") {
+	case "cancel":
+		return nil, ErrCanceled
+	case "setup_needed":
+		return nil, ErrSetupNeeded
+	}
 
 	// 11.  Verifying Assertions
 	// When the Relying Party receives a positive assertion, it MUST
@@ -29,36 +87,50 @@ func (oid *OpenID) Verify(uri string, cache DiscoveryCache, nonceStore NonceStor
 	// - The value of "openid.signed" contains all the required fields.
 	//   (Section 10.1)
 	if err = verifySignedFields(values); err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// The OP and unsolicited assertions are checked before any
+	// request to the OP.
+	if err = oid.Endpoints.Check(values.Get("openid.op_endpoint")); err != nil {
+		return nil, err
+	}
+	if err = oid.checkUnsolicited(values, tx); err != nil {
+		return nil, err
 	}
 
 	// - The signature on the assertion is valid (Section 11.4)
-	if err = verifySignature(uri, values, oid.urlGetter); err != nil {
-		return "", err
+	if err = verifySignature(ctx, values, oid.urlGetter, &oid.Limits); err != nil {
+		return nil, &SignatureError{Endpoint: values.Get("openid.op_endpoint"), Err: err}
 	}
 
 	// - The value of "openid.return_to" matches the URL of the current
 	//   request (Section 11.1)
-	if err = verifyReturnTo(parsedURL, values); err != nil {
-		return "", err
+	if err = verifyReturnTo(uri, values); err != nil {
+		requestURL := *uri
+		requestURL.RawQuery = ""
+		return nil, &ReturnToError{ReturnTo: values.Get("openid.return_to"), URL: requestURL.String(), Err: err}
 	}
 
 	// - Discovered information matches the information in the assertion
 	//   (Section 11.2)
-	if err = oid.verifyDiscovered(parsedURL, values, cache); err != nil {
-		return "", err
+	if err = oid.verifyDiscovered(ctx, uri, values, tx, cache); err != nil {
+		return nil, err
 	}
 
 	// - An assertion has not yet been accepted from this OP with the
 	//   same value for "openid.response_nonce" (Section 11.3)
 	if err = verifyNonce(values, nonceStore); err != nil {
-		return "", err
+		return nil, &NonceError{
+			Endpoint: values.Get("openid.op_endpoint"),
+			Nonce:    values.Get("openid.response_nonce"),
+			Err:      err}
 	}
 
 	// If all four of these conditions are met, assertion is now
 	// verified. If the assertion contained a Claimed Identifier, the
 	// user is now authenticated with that identifier.
-	return values.Get("openid.claimed_id"), nil
+	return newAssertion(values), nil
 }
 
 // 10.1. Positive Assertions
@@ -81,7 +153,7 @@ func verifySignedFields(vals url.Values) error {
 	}
 	for k, v := range ok {
 		if !v {
-			return fmt.Errorf("%v must be signed but isn't", k)
+			return fmt.Errorf("%w: %v must be signed but isn't", ErrInvalidAssertion, k)
 		}
 	}
 	return nil
@@ -127,30 +199,42 @@ func compareQueryParams(q1, q2 url.Values) error {
 	return nil
 }
 
-func (oid *OpenID) verifyDiscovered(uri *url.URL, vals url.Values, cache DiscoveryCache) error {
+func (oid *OpenID) verifyDiscovered(ctx context.Context, uri *url.URL, vals url.Values, tx *Transaction, cache DiscoveryCache) error {
 	version := vals.Get("openid.ns")
 	if version != "http://specs.openid.net/auth/2.0" {
-		return errors.New("Bad protocol version")
+		return fmt.Errorf("%w: bad protocol version", ErrInvalidAssertion)
 	}
 
 	endpoint := vals.Get("openid.op_endpoint")
 	if len(endpoint) == 0 {
-		return errors.New("missing openid.op_endpoint url param")
+		return fmt.Errorf("%w: missing openid.op_endpoint url param", ErrInvalidAssertion)
 	}
 	localID := vals.Get("openid.identity")
-	if len(localID) == 0 {
-		return errors.New("no localId to verify")
-	}
 	claimedID := vals.Get("openid.claimed_id")
-	if len(claimedID) == 0 {
+
+	// The end user was sent to the OP of the transaction: an assertion
+	// from another OP was not requested by this transaction.
+	if tx != nil && tx.OpEndpoint != endpoint {
+		return &DiscoveredInfoError{ClaimedID: claimedID, Endpoint: endpoint, Err: ErrEndpointMismatch}
+	}
+
+	if len(claimedID) == 0 && len(localID) == 0 {
 		// If no Claimed Identifier is present in the response, the
 		// assertion is not about an identifier and the RP MUST NOT use the
 		// User-supplied Identifier associated with the current OpenID
 		// authentication transaction to identify the user. Extension
 		// information in the assertion MAY still be used.
-		// --- This library does not support this case. So claimed
-		//     identifier must be present.
-		return errors.New("no claimed_id to verify")
+		// --- There is nothing to verify: the Assertion returned by
+		//     verify is flagged as not being about an identifier.
+		return nil
+	}
+	if len(localID) == 0 {
+		return fmt.Errorf("%w: no localId to verify", ErrInvalidAssertion)
+	}
+	if len(claimedID) == 0 {
+		// "openid.claimed_id" and "openid.identity" SHALL be either
+		// both present or both absent.
+		return fmt.Errorf("%w: no claimed_id to verify", ErrInvalidAssertion)
 	}
 
 	// 11.2.  Verifying Discovered Information
@@ -169,9 +253,16 @@ func (oid *OpenID) verifyDiscovered(uri *url.URL, vals url.Values, cache Discove
 	// information in the assertion MUST be present in the
 	// discovered information. The Claimed Identifier MUST NOT be an
 	// OP Identifier.
+	if tx != nil && len(tx.ClaimedID) > 0 &&
+		(tx.Expires.IsZero() || time.Now().Before(tx.Expires)) &&
+		tx.ClaimedID == claimedIDVerify &&
+		tx.identity() == localID {
+		return nil
+	}
 	if discovered := cache.Get(claimedIDVerify); discovered != nil &&
+		!discoveredInfoExpired(discovered, time.Now()) &&
 		discovered.OpEndpoint() == endpoint &&
-		discovered.OpLocalID() == localID &&
+		discoveredIdentity(discovered) == localID &&
 		discovered.ClaimedID() == claimedIDVerify {
 		return nil
 	}
@@ -183,18 +274,35 @@ func (oid *OpenID) verifyDiscovered(uri *url.URL, vals url.Values, cache Discove
 	// assertion), the Relying Party MUST perform discovery on the Claimed
 	// Identifier in the response to make sure that the OP is authorized to
 	// make assertions about the Claimed Identifier.
-	if ep, _, _, err := oid.Discover(claimedID); err == nil {
-		if ep == endpoint {
+	info, err := oid.discover(ctx, claimedID)
+	if err == nil {
+		if info.opEndpoint == endpoint {
 			// This claimed ID points to the same endpoint, therefore this
 			// endpoint is authorized to make assertions about that claimed ID.
 			// TODO: There may be multiple endpoints found during discovery.
 			// They should all be checked.
-			cache.Put(claimedIDVerify, &SimpleDiscoveredInfo{opEndpoint: endpoint, opLocalID: localID, claimedID: claimedIDVerify})
+			// The XRDS <Expires> element, if any, tells how long this
+			// information may be cached.
+			cache.Put(claimedIDVerify, &SimpleDiscoveredInfo{
+				opEndpoint:  endpoint,
+				opLocalID:   localID,
+				claimedID:   claimedIDVerify,
+				canonicalID: info.canonicalID,
+				expires:     info.expires})
 			return nil
 		}
 	}
 
-	return errors.New("Could not verify the claimed ID")
+	return &DiscoveredInfoError{ClaimedID: claimedID, Endpoint: endpoint, Err: err}
+}
+
+// Returns the openid.identity sent with the discovered information:
+// the OP-Local Identifier, or the claimed identifier if there is none.
+func discoveredIdentity(info DiscoveredInfo) string {
+	if localID := info.OpLocalID(); len(localID) > 0 {
+		return localID
+	}
+	return info.ClaimedID()
 }
 
 func verifyNonce(vals url.Values, store NonceStore) error {
@@ -203,7 +311,7 @@ func verifyNonce(vals url.Values, store NonceStore) error {
 	return store.Accept(endpoint, nonce)
 }
 
-func verifySignature(uri string, vals url.Values, getter httpGetter) error {
+func verifySignature(ctx context.Context, vals url.Values, getter HTTPGetter, limits *Limits) error {
 	// To have the signature verification performed by the OP, the
 	// Relying Party sends a direct request to the OP. To verify the
 	// signature, the OP uses a private association that was generated
@@ -223,28 +331,49 @@ func verifySignature(uri string, vals url.Values, getter httpGetter) error {
 			params.Add(k, v)
 		}
 	}
-	resp, err := getter.Post(vals.Get("openid.op_endpoint"), params)
+	ctx, cancel := context.WithTimeout(ctx, limits.verificationTimeout())
+	defer cancel()
+	ctx = withMaxRedirects(ctx, limits.maxRedirects())
+	endpoint := vals.Get("openid.op_endpoint")
+	resp, err := getter.Post(ctx, endpoint, params)
 	if err != nil {
-		return err
+		return &FetchError{URL: endpoint, Err: err}
 	}
 	defer resp.Body.Close()
-	content, err := ioutil.ReadAll(resp.Body)
-	response := string(content)
-	lines := strings.Split(response, "\n")
-
-	isValid := false
-	nsValid := false
-	for _, l := range lines {
-		if l == "is_valid:true" {
-			isValid = true
-		} else if l == "ns:http://specs.openid.net/auth/2.0" {
-			nsValid = true
+	if err = checkStatus(resp); err != nil {
+		// 5.1.2.2.  Error Responses: the OP MUST respond with a status
+		// code of 400, and a Key-Value Form body explaining the error.
+		if content, readErr := readBody(resp, limits.maxKeyValueSize(), "Key-Value response"); readErr == nil {
+			err.(*StatusError).Message = parseKeyValueResponse(content)["error"]
 		}
+		return err
 	}
-	if isValid && nsValid {
+	content, err := readBody(resp, limits.maxKeyValueSize(), "Key-Value response")
+	if err != nil {
+		return err
+	}
+	response := parseKeyValueResponse(content)
+	if response["ns"] != "http://specs.openid.net/auth/2.0" {
+		return &MalformedDocumentError{URL: documentURL(resp).String(),
+			Err: fmt.Errorf("unexpected ns %q", response["ns"])}
+	}
+	if response["is_valid"] == "true" {
 		// Yay !
 		return nil
 	}
 
-	return errors.New("Could not verify assertion with provider")
+	return ErrSignatureRejected
+}
+
+// Decodes a direct response in Key-Value form, like ParseKeyValueForm,
+// but ignores the lines without a colon instead of failing, so that a
+// stray line in the response of an OP does not fail the verification.
+func parseKeyValueResponse(data []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, ":"); i != -1 {
+			values[line[:i]] = line[i+1:]
+		}
+	}
+	return values
 }
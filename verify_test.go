@@ -1,7 +1,12 @@
 package openid
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -102,7 +107,7 @@ func TestVerifyDiscovered(t *testing.T) {
 		"openid.identity":    []string{"http://example.com/openid/id/foo"}}
 
 	// Make sure we fail with no discovery handler
-	if err := testInstance.verifyDiscovered(nil, vals, dc); err == nil {
+	if err := testInstance.verifyDiscovered(context.Background(), nil, vals, nil, dc); err == nil {
 		t.Errorf("verifyDiscovered succeeded unexpectedly with no discovery")
 	}
 
@@ -121,7 +126,7 @@ Content-Type: application/xrds+xml; charset=UTF-8
 </xrds:XRDS>`
 
 	// Make sure we succeed now
-	if err := testInstance.verifyDiscovered(nil, vals, dc); err != nil {
+	if err := testInstance.verifyDiscovered(context.Background(), nil, vals, nil, dc); err != nil {
 		t.Errorf("verifyDiscovered failed unexpectedly: %v", err)
 	}
 
@@ -129,7 +134,46 @@ Content-Type: application/xrds+xml; charset=UTF-8
 	delete(testGetter.urls, "http://example.com/openid/id/foo#Accept#application/xrds+xml")
 
 	// Make sure we still succeed thanks to the discovery cache
-	if err := testInstance.verifyDiscovered(nil, vals, dc); err != nil {
+	if err := testInstance.verifyDiscovered(context.Background(), nil, vals, nil, dc); err != nil {
 		t.Errorf("verifyDiscovered failed unexpectedly: %v", err)
 	}
 }
+
+func TestVerifyRequest(t *testing.T) {
+	server := newErrorsTestServer(true)
+	defer server.Close()
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	oid := NewOpenID(server.Client())
+	oid.TrustedProxies = []*net.IPNet{proxies}
+
+	vals := errorsTestAssertion(server.URL+"/op", server.URL+"/id")
+	vals.Set("openid.return_to", "https://rp.example.com/return?session=1")
+
+	// Assertion in the query, behind a TLS-terminating proxy.
+	r := httptest.NewRequest("GET", "/return?session=1&"+vals.Encode(), nil)
+	r.Host = "backend.internal"
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "rp.example.com")
+	id, err := oid.VerifyRequest(r, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if err != nil || id != server.URL+"/id" {
+		t.Errorf("Unexpected verification: %s, %v", id, err)
+	}
+
+	// Assertion in a POSTed form.
+	r = httptest.NewRequest("POST", "https://rp.example.com/return?session=1", strings.NewReader(vals.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	id, err = oid.VerifyRequest(r, NewSimpleDiscoveryCache(), NewSimpleNonceStore())
+	if err != nil || id != server.URL+"/id" {
+		t.Errorf("Unexpected verification: %s, %v", id, err)
+	}
+
+	// The headers of untrusted clients are ignored.
+	r = httptest.NewRequest("GET", "/return?session=1&"+vals.Encode(), nil)
+	r.Host = "backend.internal"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "rp.example.com")
+	if _, err = oid.VerifyRequest(r, NewSimpleDiscoveryCache(), NewSimpleNonceStore()); !errors.Is(err, ErrReturnToMismatch) {
+		t.Errorf("Expected a return_to mismatch, got %v", err)
+	}
+}
@@ -3,7 +3,9 @@ package openid
 import (
 	"encoding/xml"
 	"errors"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // TODO: As per 11.2 in openid 2 specs, a service may have multiple
@@ -12,37 +14,189 @@ import (
 type XrdsIdentifier struct {
 	Type     []string `xml:"Type"`
 	URI      string   `xml:"URI"`
-	LocalID  string   `xml:"LocalID"`
-	Priority int      `xml:"priority,attr"`
+	LocalID  string   `xml:"LocalID,omitempty"`
+	Priority int      `xml:"priority,attr,omitempty"`
+}
+
+// XrdStatus is the <Status> element of an XRD, as defined in section
+// 15 of [XRI_Resolution_2.0]. A Code of 100 means SUCCESS.
+type XrdStatus struct {
+	Code int    `xml:"code,attr,omitempty"`
+	Text string `xml:",chardata"`
 }
 
 type Xrd struct {
-	Service []*XrdsIdentifier `xml:"Service"`
+	Expires     string            `xml:"Expires,omitempty"`
+	Status      *XrdStatus        `xml:"Status"`
+	CanonicalID string            `xml:"CanonicalID,omitempty"`
+	Service     []*XrdsIdentifier `xml:"Service"`
 }
 
+// An XRDS document may contain several XRD elements, for example
+// when it is the result of following references. As per section 4.2
+// of [XRI_Resolution_2.0], only the last one describes the resource
+// that was requested.
 type XrdsDocument struct {
 	XMLName xml.Name `xml:"XRDS"`
-	Xrd     *Xrd     `xml:"XRD"`
+	Xrd     []*Xrd   `xml:"XRD"`
 }
 
-func parseXrds(input []byte) (opEndpoint, opLocalID string, err error) {
-	xrdsDoc := &XrdsDocument{}
-	err = xml.Unmarshal(input, xrdsDoc)
+// NewOPIdentifierXrds returns the XRDS document to serve for an OP
+// Identifier: it contains an OP Identifier Element (7.3.2.1.1).
+func NewOPIdentifierXrds(opEndpoint string) *XrdsDocument {
+	return &XrdsDocument{Xrd: []*Xrd{{
+		Service: []*XrdsIdentifier{{
+			Type: []string{"http://specs.openid.net/auth/2.0/server"},
+			URI:  opEndpoint,
+		}},
+	}}}
+}
+
+// NewClaimedIdentifierXrds returns the XRDS document to serve for a
+// Claimed Identifier: it contains a Claimed Identifier Element
+// (7.3.2.1.2). opLocalID is optional.
+func NewClaimedIdentifierXrds(opEndpoint, opLocalID string) *XrdsDocument {
+	return &XrdsDocument{Xrd: []*Xrd{{
+		Service: []*XrdsIdentifier{{
+			Type:    []string{"http://specs.openid.net/auth/2.0/signon"},
+			URI:     opEndpoint,
+			LocalID: opLocalID,
+		}},
+	}}}
+}
+
+// Marshal encodes the document, with an XML declaration.
+func (doc *XrdsDocument) Marshal() ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// ServeHTTP serves the document with the application/xrds+xml
+// content type.
+func (doc *XrdsDocument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	out, err := doc.Marshal()
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/xrds+xml; charset=UTF-8")
+	w.Write(out)
+}
+
+// MarshalXML encodes the document with the namespaces defined in
+// [XRI_Resolution_2.0]: the root element is in the "xri://$xrds"
+// namespace, and the XRD elements in "xri://$xrd*($v*2.0)".
+func (doc *XrdsDocument) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// encoding/xml does not let us choose namespace prefixes, so the
+	// prefixed names are written as is.
+	start = xml.StartElement{
+		Name: xml.Name{Local: "xrds:XRDS"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "xmlns:xrds"}, Value: "xri://$xrds"},
+			{Name: xml.Name{Local: "xmlns"}, Value: "xri://$xrd*($v*2.0)"},
+		},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, xrd := range doc.Xrd {
+		if err := e.EncodeElement(xrd, xml.StartElement{Name: xml.Name{Local: "XRD"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// FinalXrd returns the authoritative (last) XRD of the document, or
+// nil if there is none.
+func (doc *XrdsDocument) FinalXrd() *Xrd {
+	if len(doc.Xrd) == 0 {
+		return nil
+	}
+	return doc.Xrd[len(doc.Xrd)-1]
+}
+
+// ExpiresAt returns the time after which the XRD must not be used
+// anymore. ok is false if the XRD has no valid <Expires> element.
+func (xrd *Xrd) ExpiresAt() (t time.Time, ok bool) {
+	expires := strings.TrimSpace(xrd.Expires)
+	if len(expires) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, expires)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func parseXrdsDocument(input []byte) (*XrdsDocument, error) {
+	xrdsDoc := &XrdsDocument{}
+	if err := xml.Unmarshal(input, xrdsDoc); err != nil {
+		return nil, &MalformedDocumentError{Err: err}
+	}
 
-	if xrdsDoc.Xrd == nil {
-		return "", "", errors.New("XRDS document missing XRD tag")
+	xrd := xrdsDoc.FinalXrd()
+	if xrd == nil {
+		return nil, &MalformedDocumentError{Err: errors.New("XRDS document missing XRD tag")}
+	}
+	// A missing status is considered a success.
+	if xrd.Status != nil && xrd.Status.Code != 0 && xrd.Status.Code != 100 {
+		return nil, errors.New("XRD status is not SUCCESS: " +
+			strings.TrimSpace(xrd.Status.Text))
 	}
+	return xrdsDoc, nil
+}
+
+func parseXrds(input []byte) (opEndpoint, opLocalID string, err error) {
+	xrdsDoc, err := parseXrdsDocument(input)
+	if err != nil {
+		return "", "", err
+	}
+	opEndpoint, opLocalID, _, err = xrdsDoc.FinalXrd().openIDService()
+	return
+}
+
+// Builds the discovered information from an XRDS document, including
+// the CanonicalID and the expiration time of the final XRD. claimedID
+// is only used if a Claimed Identifier Element is found: there is no
+// claimed identifier for an OP Identifier Element.
+func xrdsDiscoveredInfo(input []byte, claimedID string) (*SimpleDiscoveredInfo, error) {
+	xrdsDoc, err := parseXrdsDocument(input)
+	if err != nil {
+		return nil, err
+	}
+	xrd := xrdsDoc.FinalXrd()
+	opEndpoint, opLocalID, opIdentifier, err := xrd.openIDService()
+	if err != nil {
+		return nil, err
+	}
+	if opIdentifier {
+		claimedID = ""
+	}
+	info := &SimpleDiscoveredInfo{
+		claimedID:   claimedID,
+		opEndpoint:  opEndpoint,
+		opLocalID:   opLocalID,
+		canonicalID: strings.TrimSpace(xrd.CanonicalID),
+	}
+	if expires, ok := xrd.ExpiresAt(); ok {
+		info.expires = expires
+	}
+	return info, nil
+}
 
+func (xrd *Xrd) openIDService() (opEndpoint, opLocalID string, opIdentifier bool, err error) {
 	// 7.3.2.2.  Extracting Authentication Data
 	// Once the Relying Party has obtained an XRDS document, it
 	// MUST first search the document (following the rules
 	// described in [XRI_Resolution_2.0]) for an OP Identifier
 	// Element. If none is found, the RP will search for a Claimed
 	// Identifier Element.
-	for _, service := range xrdsDoc.Xrd.Service {
+	for _, service := range xrd.Service {
 		// 7.3.2.1.1.  OP Identifier Element
 		// An OP Identifier Element is an <xrd:Service> element with the
 		// following information:
@@ -51,10 +205,11 @@ func parseXrds(input []byte) (opEndpoint, opLocalID string, err error) {
 		// An <xrd:URI> tag whose text content is the OP Endpoint URL
 		if service.hasType("http://specs.openid.net/auth/2.0/server") {
 			opEndpoint = strings.TrimSpace(service.URI)
+			opIdentifier = true
 			return
 		}
 	}
-	for _, service := range xrdsDoc.Xrd.Service {
+	for _, service := range xrd.Service {
 		// 7.3.2.1.2.  Claimed Identifier Element
 		// A Claimed Identifier Element is an <xrd:Service> element
 		// with the following information:
@@ -70,7 +225,7 @@ func parseXrds(input []byte) (opEndpoint, opLocalID string, err error) {
 			return
 		}
 	}
-	return "", "", errors.New("Could not find a compatible service")
+	return "", "", false, ErrNoService
 }
 
 func (xrdsi *XrdsIdentifier) hasType(tpe string) bool {
@@ -2,6 +2,7 @@ package openid
 
 import (
 	"testing"
+	"time"
 )
 
 func TestXrds(t *testing.T) {
@@ -70,6 +71,98 @@ xmlns:openid="http://openid.net/xmlns/1.0">
 		"")
 }
 
+func TestXrdsMultipleXrd(t *testing.T) {
+	// Only the last XRD is authoritative.
+	xrds := []byte(`
+<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Status code="100">SUCCESS</Status>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/server</Type>
+      <URI>https://first.example.com/</URI>
+    </Service>
+  </XRD>
+  <XRD>
+    <Status code="100">SUCCESS</Status>
+    <Expires>2030-01-02T03:04:05Z</Expires>
+    <CanonicalID>=!1234.5678</CanonicalID>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/signon</Type>
+      <URI>https://last.example.com/</URI>
+      <LocalID>https://user.last.example.com/</LocalID>
+    </Service>
+  </XRD>
+</xrds:XRDS>`)
+	testExpectOpID(t, xrds,
+		"https://last.example.com/",
+		"https://user.last.example.com/")
+
+	info, err := xrdsDiscoveredInfo(xrds, "http://example.com/")
+	if err != nil {
+		t.Fatalf("Got an error parsing XRDS: %s", err)
+	}
+	if info.ClaimedID() != "http://example.com/" {
+		t.Errorf("Unexpected ClaimedID: %s", info.ClaimedID())
+	}
+	if info.CanonicalID() != "=!1234.5678" {
+		t.Errorf("Unexpected CanonicalID: %s", info.CanonicalID())
+	}
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if !info.Expires().Equal(expires) {
+		t.Errorf("Unexpected expiration: Expected %s, Got %s",
+			expires, info.Expires())
+	}
+}
+
+func TestXrdsBadStatus(t *testing.T) {
+	_, _, err := parseXrds([]byte(`
+<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Status code="222">QUERY_NOT_FOUND</Status>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/server</Type>
+      <URI>foo</URI>
+    </Service>
+  </XRD>
+</xrds:XRDS>`))
+	if err == nil {
+		t.Errorf("Expected an error for a non-SUCCESS XRD status")
+	}
+}
+
+func TestXrdsMarshalRoundTrip(t *testing.T) {
+	xrds, err := NewOPIdentifierXrds("https://op.example.com/server").Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	testExpectOpID(t, xrds, "https://op.example.com/server", "")
+
+	xrds, err = NewClaimedIdentifierXrds("https://op.example.com/server",
+		"https://op.example.com/id/alice").Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	testExpectOpID(t, xrds,
+		"https://op.example.com/server",
+		"https://op.example.com/id/alice")
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<xrds:XRDS xmlns:xrds="xri://$xrds" xmlns="xri://$xrd*($v*2.0)">
+  <XRD>
+    <Service>
+      <Type>http://specs.openid.net/auth/2.0/signon</Type>
+      <URI>https://op.example.com/server</URI>
+      <LocalID>https://op.example.com/id/alice</LocalID>
+    </Service>
+  </XRD>
+</xrds:XRDS>`
+	if string(xrds) != expected {
+		t.Errorf("Unexpected XRDS document:\n%s", xrds)
+	}
+}
+
 func testExpectOpID(t *testing.T, xrds []byte, op, id string) {
 	receivedOp, receivedID, err := parseXrds(xrds)
 	if err != nil {
@@ -1,9 +1,10 @@
 package openid
 
 import (
+	"context"
 	"errors"
 	"io"
-	"io/ioutil"
+	"net/http"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -12,7 +13,7 @@ import (
 var yadisHeaders = map[string]string{
 	"Accept": "application/xrds+xml"}
 
-func yadisDiscovery(id string, getter httpGetter) (opEndpoint string, opLocalID string, err error) {
+func yadisDiscovery(ctx context.Context, id string, getter HTTPGetter, limits *Limits) (info *SimpleDiscoveredInfo, err error) {
 	// Section 6.2.4 of Yadis 1.0 specifications.
 	// The Yadis Protocol is initiated by the Relying Party Agent
 	// with an initial HTTP request using the Yadis URL.
@@ -22,12 +23,21 @@ func yadisDiscovery(id string, getter httpGetter) (opEndpoint string, opLocalID
 	// A GET or HEAD request MAY include an HTTP Accept
 	// request-header (HTTP 14.1) specifying MIME media type,
 	// application/xrds+xml.
-	resp, err := getter.Get(id, yadisHeaders)
+	resp, err := getter.Get(ctx, id, yadisHeaders)
 	if err != nil {
-		return "", "", err
+		return nil, &FetchError{URL: id, Err: err}
 	}
 
 	defer resp.Body.Close()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	// From OpenID specs, 7.2: URL Identifiers MUST then be further
+	// normalized by both following redirects when retrieving their
+	// content and finally applying the rules in Section 6 of [RFC3986]
+	// to the final destination URL.
+	claimedID := normalizeURL(documentURL(resp))
 
 	// Section 6.2.5 from Yadis 1.0 spec: Response
 
@@ -38,66 +48,120 @@ func yadisDiscovery(id string, getter httpGetter) (opEndpoint string, opLocalID
 	if l := resp.Header.Get("X-XRDS-Location"); l != "" {
 		// 2. HTTP response-headers that include an X-XRDS-Location
 		// response-header, together with a document
-		return getYadisResourceDescriptor(l, getter)
+		location, err := resolveURL(documentURL(resp), "", l)
+		if err != nil {
+			return nil, err
+		}
+		return getYadisResourceDescriptor(ctx, location, claimedID, getter, limits)
 	} else if strings.Contains(contentType, "text/html") {
 		// 1. An HTML document with a <head> element that includes a
 		// <meta> element with http-equiv attribute, X-XRDS-Location,
 
-		metaContent, err := findMetaXrdsLocation(resp.Body)
-		if err == nil {
-			return getYadisResourceDescriptor(metaContent, getter)
+		metaContent, baseHref, err := findMetaXrdsLocation(limitReader(resp.Body, limits.maxHTMLSize(), "HTML document"))
+		if err != nil {
+			return nil, err
 		}
-		return "", "", err
+		location, err := resolveURL(documentURL(resp), baseHref, metaContent)
+		if err != nil {
+			return nil, err
+		}
+		return getYadisResourceDescriptor(ctx, location, claimedID, getter, limits)
 	} else if strings.Contains(contentType, "application/xrds+xml") {
 		// 4. A document of MIME media type, application/xrds+xml.
-		body, err := ioutil.ReadAll(resp.Body)
-		if err == nil {
-			return parseXrds(body)
-		}
-		return "", "", err
+		return xrdsResponseInfo(resp, claimedID, limits)
 	}
 	// 3. HTTP response-headers only, which MAY include an
 	// X-XRDS-Location response-header, a content-type
 	// response-header specifying MIME media type,
 	// application/xrds+xml, or both.
 	//   (this is handled by one of the 2 previous if statements)
-	return "", "", errors.New("No expected header, or content type")
+	return nil, errors.New("No expected header, or content type")
+}
+
+// Same as yadisDiscovery, but using a HEAD request. This only succeeds
+// if the response headers are enough to locate the XRDS document
+// (case 3 of section 6.2.5 of the Yadis 1.0 spec). The caller should
+// fall back to yadisDiscovery otherwise.
+func yadisHeadDiscovery(ctx context.Context, id string, getter HTTPGetter, limits *Limits) (info *SimpleDiscoveredInfo, err error) {
+	resp, err := getter.Head(ctx, id, yadisHeaders)
+	if err != nil {
+		return nil, &FetchError{URL: id, Err: err}
+	}
+	resp.Body.Close()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
+	claimedID := normalizeURL(documentURL(resp))
+
+	if l := resp.Header.Get("X-XRDS-Location"); l != "" {
+		location, err := resolveURL(documentURL(resp), "", l)
+		if err != nil {
+			return nil, err
+		}
+		return getYadisResourceDescriptor(ctx, location, claimedID, getter, limits)
+	} else if strings.Contains(resp.Header.Get("Content-Type"), "application/xrds+xml") {
+		// The XRDS document is served at this very URL, we need a GET
+		// to retrieve it.
+		return getYadisResourceDescriptor(ctx, documentURL(resp).String(), claimedID, getter, limits)
+	}
+	return nil, errors.New("No X-XRDS-Location header in HEAD response")
 }
 
 // Similar as above, but we expect an absolute Yadis document URL.
-func getYadisResourceDescriptor(id string, getter httpGetter) (opEndpoint string, opLocalID string, err error) {
-	resp, err := getter.Get(id, yadisHeaders)
+// claimedID is the normalized Yadis URL the document was found from.
+func getYadisResourceDescriptor(ctx context.Context, id, claimedID string, getter HTTPGetter, limits *Limits) (info *SimpleDiscoveredInfo, err error) {
+	resp, err := getter.Get(ctx, id, yadisHeaders)
 	if err != nil {
-		return "", "", err
+		return nil, &FetchError{URL: id, Err: err}
 	}
 	defer resp.Body.Close()
+	if err = checkStatus(resp); err != nil {
+		return nil, err
+	}
 	// 4. A document of MIME media type, application/xrds+xml.
-	body, err := ioutil.ReadAll(resp.Body)
-	if err == nil {
-		return parseXrds(body)
+	return xrdsResponseInfo(resp, claimedID, limits)
+}
+
+// Reads the XRDS document in resp, and extracts the discovered
+// information from it.
+func xrdsResponseInfo(resp *http.Response, claimedID string, limits *Limits) (*SimpleDiscoveredInfo, error) {
+	body, err := readBody(resp, limits.maxXrdsSize(), "XRDS document")
+	if err != nil {
+		return nil, err
+	}
+	info, err := xrdsDiscoveredInfo(body, claimedID)
+	if err != nil {
+		var malformed *MalformedDocumentError
+		if errors.As(err, &malformed) {
+			malformed.URL = documentURL(resp).String()
+		}
+		return nil, err
 	}
-	return "", "", err
+	return resolveDiscoveredInfo(info, documentURL(resp))
 }
 
 // Search for
 // <head>
 //    <meta http-equiv="X-XRDS-Location" content="....">
-func findMetaXrdsLocation(input io.Reader) (location string, err error) {
+// baseHref is the href of the <base> element found in <head>, if any.
+func findMetaXrdsLocation(input io.Reader) (location, baseHref string, err error) {
 	tokenizer := html.NewTokenizer(input)
 	inHead := false
 	for {
 		tt := tokenizer.Next()
 		switch tt {
 		case html.ErrorToken:
-			return "", tokenizer.Err()
+			return "", "", tokenizer.Err()
 		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
 			tk := tokenizer.Token()
 			if tk.Data == "head" {
 				if tt == html.StartTagToken {
 					inHead = true
 				} else {
-					return "", errors.New("Meta X-XRDS-Location not found")
+					return "", "", errors.New("Meta X-XRDS-Location not found")
 				}
+			} else if inHead && tk.Data == "base" && len(baseHref) == 0 {
+				baseHref = attrValue(tk, "href")
 			} else if inHead && tk.Data == "meta" {
 				ok := false
 				content := ""
@@ -110,10 +174,9 @@ func findMetaXrdsLocation(input io.Reader) (location string, err error) {
 					}
 				}
 				if ok && len(content) > 0 {
-					return content, nil
+					return content, baseHref, nil
 				}
 			}
 		}
 	}
-	return "", errors.New("Meta X-XRDS-Location not found")
 }
@@ -40,7 +40,7 @@ func TestNoMetaXrdsLocation(t *testing.T) {
 
 func searchMeta(t *testing.T, doc, loc string, err bool) {
 	r := bytes.NewReader([]byte(doc))
-	res, e := findMetaXrdsLocation(r)
+	res, _, e := findMetaXrdsLocation(r)
 	if (e != nil) != err {
 		t.Errorf("Unexpected error: '%s'", e)
 	} else if e == nil {